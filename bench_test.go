@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"engo.io/ecs"
+	"engo.io/engo"
+)
+
+var (
+	benchWorlds = []struct {
+		size, population int
+	}{{32, 100}, {64, 400}, {128, 1600}} // Synthetic world sizes in tiles, and the populations that the simulation benchmarks keep in them
+	benchTicks = 60 // Number of ticks a simulation is run for before the simulation benchmarks start timing it
+)
+
+// newBenchmarkScene sets up a headless synthetic world that's size by size tiles and runs it for benchTicks ticks,
+// so that it has filled up with population creatures and they've started moving
+func newBenchmarkScene(b *testing.B, size, population int) (*ecs.World, *MapScene) {
+	b.Helper()
+	world, ms := newTestScene(b, size, population, 1)
+	for i := 0; i < benchTicks; i++ {
+		world.Update(1.0 / 60)
+	}
+	return world, ms
+}
+
+// BenchmarkSyntheticSetup generates a synthetic map and adds the simulation systems, without any creatures
+func BenchmarkSyntheticSetup(b *testing.B) {
+	mailbox := engo.Mailbox
+	b.Cleanup(func() { engo.Mailbox = mailbox })
+	for _, w := range benchWorlds {
+		b.Run(fmt.Sprintf("size=%d", w.size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				engo.Mailbox = &engo.MessageManager{} // So that listeners from old scenes don't pile up
+				ms := &MapScene{}
+				ms.setupSynthetic(&ecs.World{}, w.size, w.size, 0, 1)
+			}
+		})
+	}
+}
+
+// BenchmarkCreatureManagerUpdate runs a tick of the creature manager, without stepping physics
+func BenchmarkCreatureManagerUpdate(b *testing.B) {
+	for _, w := range benchWorlds {
+		b.Run(fmt.Sprintf("size=%d/creatures=%d", w.size, w.population), func(b *testing.B) {
+			_, ms := newBenchmarkScene(b, w.size, w.population)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ms.creatureManager.Update(1.0 / 60)
+			}
+		})
+	}
+}
+
+// BenchmarkPhysicsUpdate steps physics on its own
+// Nothing listens for its messages while it's timed, so contacts don't spawn creatures and syncs don't rebuild the creature hash
+func BenchmarkPhysicsUpdate(b *testing.B) {
+	for _, w := range benchWorlds {
+		b.Run(fmt.Sprintf("size=%d/creatures=%d", w.size, w.population), func(b *testing.B) {
+			_, ms := newBenchmarkScene(b, w.size, w.population)
+			engo.Mailbox = &engo.MessageManager{} // newTestScene puts the old one back once we're done
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ms.creatureManager.physics.Update(1.0 / 60)
+			}
+		})
+	}
+}
+
+// BenchmarkWorldUpdate runs a whole tick of every simulation system, like the game does every frame
+func BenchmarkWorldUpdate(b *testing.B) {
+	for _, w := range benchWorlds {
+		b.Run(fmt.Sprintf("size=%d/creatures=%d", w.size, w.population), func(b *testing.B) {
+			world, _ := newBenchmarkScene(b, w.size, w.population)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				world.Update(1.0 / 60)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+// brainTopology is the shape of a network, brains can only be evaluated together if they have the same one
+type brainTopology struct {
+	inputs, hidden, outputs int
+}
+
+// brainBatch holds every brain with a single topology packed into contiguous row-major matrices, one row per creature
+type brainBatch struct {
+	brainTopology
+	creatures     []*Creature
+	inputs        []float32 // len(creatures) x inputs
+	hiddenWeights []float32 // len(creatures) x hidden
+	hidden        []float32 // len(creatures) x hidden
+	outputWeights []float32 // len(creatures) x outputs
+	outputs       []float32 // len(creatures) x outputs
+}
+
+// brainBatches evaluates brains by packing them into a brainBatch per topology
+// The buffers are kept between calls so that we don't allocate every tick
+type brainBatches map[brainTopology]*brainBatch
+
+// think does the same thing as calling think on every creature, but it packs the brains first and evaluates them with tight loops
+// The creatures must already have sensed their inputs
+func (bb *brainBatches) think(creatures []*Creature) {
+	if *bb == nil {
+		*bb = make(brainBatches)
+	}
+	for _, b := range *bb {
+		b.creatures = b.creatures[:0]
+	}
+	for _, c := range creatures {
+		t := brainTopology{inputs: len(c.Input), hidden: len(c.HiddenLayer), outputs: len(c.Output)}
+		b, ok := (*bb)[t]
+		if !ok {
+			b = &brainBatch{brainTopology: t}
+			(*bb)[t] = b
+		}
+		b.creatures = append(b.creatures, c)
+	}
+
+	for t, b := range *bb {
+		if len(b.creatures) == 0 {
+			delete(*bb, t) // Nobody has this topology any more
+			continue
+		}
+		b.pack()
+		parallelBatches(len(b.creatures), b.evaluate)
+		b.unpack()
+	}
+}
+
+// pack copies the inputs and weights of every creature into the matrices
+func (b *brainBatch) pack() {
+	n := len(b.creatures)
+	b.inputs = resize(b.inputs, n*b.brainTopology.inputs)
+	b.hiddenWeights = resize(b.hiddenWeights, n*b.brainTopology.hidden)
+	b.hidden = resize(b.hidden, n*b.brainTopology.hidden)
+	b.outputWeights = resize(b.outputWeights, n*b.brainTopology.outputs)
+	b.outputs = resize(b.outputs, n*b.brainTopology.outputs)
+
+	for row, c := range b.creatures {
+		in := b.inputs[row*b.brainTopology.inputs:]
+		for j, neuron := range c.Input {
+			in[j] = neuron.Value
+		}
+		hw := b.hiddenWeights[row*b.brainTopology.hidden:]
+		for i, axon := range c.HiddenLayer {
+			hw[i] = axon.Weight
+		}
+		ow := b.outputWeights[row*b.brainTopology.outputs:]
+		for k, axon := range c.Output {
+			ow[k] = axon.Weight
+		}
+	}
+}
+
+// evaluate runs the networks in rows [start, end), it has the signature parallelBatches wants
+// The sums are done in the same order as in think so that both give exactly the same results
+func (b *brainBatch) evaluate(start, end int) {
+	nIn, nHidden, nOut := b.brainTopology.inputs, b.brainTopology.hidden, b.brainTopology.outputs
+	for row := start; row < end; row++ {
+		in := b.inputs[row*nIn : (row+1)*nIn]
+		hw := b.hiddenWeights[row*nHidden : (row+1)*nHidden]
+		hidden := b.hidden[row*nHidden : (row+1)*nHidden]
+		ow := b.outputWeights[row*nOut : (row+1)*nOut]
+		out := b.outputs[row*nOut : (row+1)*nOut]
+
+		for i, w := range hw {
+			var wSum float32
+			for _, v := range in {
+				wSum += v * w
+			}
+			hidden[i] = wSum
+		}
+		for k, w := range ow {
+			var wSum float32
+			for _, v := range hidden {
+				wSum += v * w
+			}
+			out[k] = wSum
+		}
+	}
+}
+
+// unpack copies the results back into every creature's brain
+func (b *brainBatch) unpack() {
+	for row, c := range b.creatures {
+		hidden := b.hidden[row*b.brainTopology.hidden:]
+		for i := range c.HiddenLayer {
+			c.HiddenLayer[i].Value = hidden[i]
+		}
+		out := b.outputs[row*b.brainTopology.outputs:]
+		for k := range c.Output {
+			c.Output[k].Value = out[k]
+		}
+	}
+}
+
+// resize returns s with length n, reusing its backing array if it's big enough
+func resize(s []float32, n int) []float32 {
+	if cap(s) < n {
+		return make([]float32, n)
+	}
+	return s[:n]
+}
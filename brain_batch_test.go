@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var benchPopulations = []int{100, 1000, 10000} // Population sizes that the brain benchmarks are run with
+
+func TestBrainBatchesMatchThink(t *testing.T) {
+	withBrainWorkers(t, 8, 16)
+	creatures := senseCreatures(t, largeWorldSize, largePopulation)
+
+	var brains brainBatches
+	brains.think(creatures)
+	batched := make([][]Axon, len(creatures))
+	hidden := make([][]Axon, len(creatures))
+	for i, c := range creatures {
+		batched[i] = append([]Axon(nil), c.Output...)
+		hidden[i] = append([]Axon(nil), c.HiddenLayer...)
+	}
+	for i, c := range creatures {
+		c.think()
+		if !reflect.DeepEqual(c.Output, batched[i]) || !reflect.DeepEqual(c.HiddenLayer, hidden[i]) {
+			t.Fatalf("creature %d thought %v batched, but %v on its own", c.ID(), batched[i], c.Output)
+		}
+	}
+}
+
+// BenchmarkThink evaluates brains one creature at a time on the worker pool
+func BenchmarkThink(b *testing.B) {
+	for _, n := range benchPopulations {
+		b.Run(fmt.Sprintf("creatures=%d", n), func(b *testing.B) {
+			creatures := senseCreatures(b, largeWorldSize, n)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				thinkAll(creatures)
+			}
+		})
+	}
+}
+
+// BenchmarkThinkBatched evaluates brains packed into matrices on the worker pool
+func BenchmarkThinkBatched(b *testing.B) {
+	for _, n := range benchPopulations {
+		b.Run(fmt.Sprintf("creatures=%d", n), func(b *testing.B) {
+			creatures := senseCreatures(b, largeWorldSize, n)
+			var brains brainBatches
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				brains.think(creatures)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package chipecs
+
+import (
+	"math"
+
+	"engo.io/ecs"
+	"engo.io/engo"
+	"github.com/vova616/chipmunk"
+	"github.com/vova616/chipmunk/vect"
+)
+
+// contactHandler implements chipmunk.CollisionCallback, and queues up contacts for the PhysicsSystem
+// We can't dispatch messages straight from the callbacks because subscribers may want to
+// add or remove bodies, which isn't safe in the middle of a step
+type contactHandler struct {
+	ps *PhysicsSystem
+}
+
+// CollisionEnter is called by chipmunk when two shapes start touching
+// Returning false makes chipmunk ignore the collision, which we do if the shapes' filters say so
+func (h contactHandler) CollisionEnter(arbiter *chipmunk.Arbiter) bool {
+	if !shapeFilter(arbiter.ShapeA).Collides(shapeFilter(arbiter.ShapeB)) {
+		return false
+	}
+	h.ps.queueContact(arbiter, ContactBegin)
+	return true
+}
+
+// CollisionPreSolve is called by chipmunk before a collision is solved
+func (h contactHandler) CollisionPreSolve(arbiter *chipmunk.Arbiter) bool {
+	return shapeFilter(arbiter.ShapeA).Collides(shapeFilter(arbiter.ShapeB))
+}
+
+// CollisionPostSolve is called by chipmunk after a collision is solved
+func (h contactHandler) CollisionPostSolve(arbiter *chipmunk.Arbiter) {}
+
+// CollisionExit is called by chipmunk when two shapes stop touching
+func (h contactHandler) CollisionExit(arbiter *chipmunk.Arbiter) {
+	if !shapeFilter(arbiter.ShapeA).Collides(shapeFilter(arbiter.ShapeB)) {
+		return // We never reported that these started touching
+	}
+	h.ps.queueContact(arbiter, ContactEnd)
+}
+
+// shapeFilter finds the CollisionFilter of shape, which we keep in its UserData
+func shapeFilter(shape *chipmunk.Shape) CollisionFilter {
+	switch data := shape.UserData.(type) {
+	case *PhysicsComponent:
+		return data.CollisionFilter
+	case CollisionFilter:
+		return data
+	}
+	return CollisionFilter{}
+}
+
+// queueContact adds a ContactMessage for arbiter to be dispatched once the step is done
+func (ps *PhysicsSystem) queueContact(arbiter *chipmunk.Arbiter, phase ContactPhase) {
+	a, b := arbiter.BodyA, arbiter.BodyB
+	entityA, _ := a.UserData.(*ecs.BasicEntity)
+	entityB, _ := b.UserData.(*ecs.BasicEntity)
+	if entityA == nil {
+		// Make sure that Entity is the one that's never nil
+		a, b = b, a
+		entityA, entityB = entityB, entityA
+	}
+	if entityA == nil {
+		return
+	}
+
+	// Both bodies might have a handler, so only report each pair once
+	key := contactKey{a: a, b: b, phase: phase}
+	if entityB != nil && entityB.ID() < entityA.ID() {
+		key.a, key.b = b, a
+	}
+	if ps.seen[key] {
+		return
+	}
+	ps.seen[key] = true
+
+	m := ContactMessage{Entity: entityA, To: entityB, Phase: phase}
+	if phase == ContactBegin && arbiter.NumContacts > 0 {
+		contact := &arbiter.Contacts[0]
+		normal := contact.Normal()
+		if a != arbiter.BodyA {
+			normal = vect.Mult(normal, -1)
+		}
+		point := contact.Position()
+		m.Point = engo.Point{X: float32(point.X), Y: float32(point.Y)}
+		m.Normal = engo.Point{X: float32(normal.X), Y: float32(normal.Y)}
+
+		relativeVelocity := vect.Sub(b.Velocity(), a.Velocity())
+		m.Impulse = float32(math.Abs(float64(vect.Dot(relativeVelocity, normal)))) * reducedMass(a, b)
+	}
+	ps.contacts = append(ps.contacts, m)
+}
+
+// step steps the space by dt
+// Pairs are only deduplicated within a single step, so a pair that stops and starts touching again in a later step is reported again
+func (ps *PhysicsSystem) step(dt vect.Float) {
+	for key := range ps.seen {
+		delete(ps.seen, key)
+	}
+	ps.Space.Step(dt)
+}
+
+// dispatchContacts sends every queued ContactMessage to engo.Mailbox
+func (ps *PhysicsSystem) dispatchContacts() {
+	contacts := ps.contacts
+	ps.contacts = nil
+	for _, m := range contacts {
+		engo.Mailbox.Dispatch(m)
+	}
+}
+
+// reducedMass is the effective mass of two bodies colliding, static bodies have infinite mass
+func reducedMass(a, b *chipmunk.Body) float32 {
+	massA, massB := float64(a.Mass()), float64(b.Mass())
+	switch {
+	case math.IsInf(massA, 1):
+		return float32(massB)
+	case math.IsInf(massB, 1):
+		return float32(massA)
+	}
+	return float32(massA * massB / (massA + massB))
+}
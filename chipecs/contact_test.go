@@ -0,0 +1,76 @@
+package chipecs
+
+import (
+	"testing"
+
+	"engo.io/ecs"
+	"github.com/vova616/chipmunk"
+	"github.com/vova616/chipmunk/vect"
+)
+
+// newContactBody makes a body with a circle shape, owned by basic unless it's nil
+func newContactBody(basic *ecs.BasicEntity) *chipmunk.Body {
+	body := chipmunk.NewBody(1, 1)
+	body.AddShape(chipmunk.NewCircle(vect.Vector_Zero, 10))
+	if basic != nil {
+		body.UserData = basic
+	}
+	return body
+}
+
+// arbiter is what chipmunk hands to the callbacks of a and b when they touch
+func arbiter(a, b *chipmunk.Body) *chipmunk.Arbiter {
+	return &chipmunk.Arbiter{BodyA: a, BodyB: b, ShapeA: a.Shapes[0], ShapeB: b.Shapes[0]}
+}
+
+func TestContactsReportedOncePerStep(t *testing.T) {
+	ps := &PhysicsSystem{}
+	ps.New(nil)
+	h := contactHandler{ps}
+	basicA, basicB := ecs.NewBasic(), ecs.NewBasic()
+	a, b := newContactBody(&basicA), newContactBody(&basicB)
+
+	// Both bodies have handlers, so chipmunk tells us about the pair twice, once from each side
+	h.CollisionEnter(arbiter(a, b))
+	h.CollisionEnter(arbiter(b, a))
+	ps.step(1.0 / 60)
+	h.CollisionExit(arbiter(a, b))
+	h.CollisionExit(arbiter(b, a))
+	ps.step(1.0 / 60)
+	h.CollisionEnter(arbiter(b, a))
+	h.CollisionEnter(arbiter(a, b))
+	h.CollisionEnter(arbiter(a, b))
+
+	want := []ContactPhase{ContactBegin, ContactEnd, ContactBegin}
+	if len(ps.contacts) != len(want) {
+		t.Fatalf("got %d contacts %+v, want %d", len(ps.contacts), ps.contacts, len(want))
+	}
+	for i, m := range ps.contacts {
+		if m.Phase != want[i] {
+			t.Errorf("contact %d has phase %v, want %v", i, m.Phase, want[i])
+		}
+		if m.To == nil || !(m.Entity == &basicA && m.To == &basicB || m.Entity == &basicB && m.To == &basicA) {
+			t.Errorf("contact %d is between %v and %v, want the two entities", i, m.Entity, m.To)
+		}
+	}
+}
+
+func TestContactEntityIsNeverNil(t *testing.T) {
+	ps := &PhysicsSystem{}
+	ps.New(nil)
+	h := contactHandler{ps}
+	basic := ecs.NewBasic()
+	wall, creature := newContactBody(nil), newContactBody(&basic)
+
+	// Only the second body belongs to an entity, so it has to become Entity
+	h.CollisionEnter(arbiter(wall, creature))
+	// Neither body belongs to an entity, so there's nobody to tell
+	h.CollisionEnter(arbiter(newContactBody(nil), newContactBody(nil)))
+
+	if len(ps.contacts) != 1 {
+		t.Fatalf("got %d contacts %+v, want 1", len(ps.contacts), ps.contacts)
+	}
+	if m := ps.contacts[0]; m.Entity != &basic || m.To != nil {
+		t.Errorf("contact is from %v to %v, want from the creature to nil", m.Entity, m.To)
+	}
+}
@@ -0,0 +1,259 @@
+package chipecs
+
+import (
+	"math"
+
+	"engo.io/ecs"
+	"engo.io/engo"
+	"github.com/vova616/chipmunk"
+	"github.com/vova616/chipmunk/vect"
+)
+
+// PointQuery returns the IDs of every entity whose shape contains p
+// Only shapes with a category in mask are considered, a mask of 0 means every category
+func (ps *PhysicsSystem) PointQuery(p engo.Point, mask CollisionCategory) []uint64 {
+	return ps.RadiusQuery(p, 0, mask)
+}
+
+// RadiusQuery returns the IDs of every entity whose shape is within radius of p, each one only once
+// even if more than one of its shapes is
+// Only shapes with a category in mask are considered, a mask of 0 means every category
+func (ps *PhysicsSystem) RadiusQuery(p engo.Point, radius float32, mask CollisionCategory) []uint64 {
+	var ids []uint64
+	seen := make(map[uint64]bool)
+	point := vect.Vect{X: vect.Float(p.X), Y: vect.Float(p.Y)}
+	ps.query(around(point, vect.Float(radius)), mask, func(id uint64, shape *chipmunk.Shape) {
+		if !seen[id] && shapeDistance(shape, point) <= vect.Float(radius) {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	})
+	return ids
+}
+
+// Nearest returns the ID of the entity whose shape is closest to p, as long as it's within maxDistance
+// Only shapes with a category in mask are considered, a mask of 0 means every category
+// ok is false if there's nothing within maxDistance
+func (ps *PhysicsSystem) Nearest(p engo.Point, maxDistance float32, mask CollisionCategory) (id uint64, ok bool) {
+	point := vect.Vect{X: vect.Float(p.X), Y: vect.Float(p.Y)}
+	closest := vect.Float(maxDistance)
+	ps.query(around(point, closest), mask, func(shapeID uint64, shape *chipmunk.Shape) {
+		if d := shapeDistance(shape, point); d <= closest {
+			closest, id, ok = d, shapeID, true
+		}
+	})
+	return id, ok
+}
+
+// Raycast returns the ID of the first entity whose shape is hit by the segment from start to end,
+// along with where it was hit
+// Only shapes with a category in mask are considered, a mask of 0 means every category
+// ok is false if the segment doesn't hit anything
+func (ps *PhysicsSystem) Raycast(start, end engo.Point, mask CollisionCategory) (id uint64, hit engo.Point, ok bool) {
+	a := vect.Vect{X: vect.Float(start.X), Y: vect.Float(start.Y)}
+	b := vect.Vect{X: vect.Float(end.X), Y: vect.Float(end.Y)}
+	bb := chipmunk.AABB{
+		Lower: vect.Vect{X: vect.Float(math.Min(float64(a.X), float64(b.X))), Y: vect.Float(math.Min(float64(a.Y), float64(b.Y)))},
+		Upper: vect.Vect{X: vect.Float(math.Max(float64(a.X), float64(b.X))), Y: vect.Float(math.Max(float64(a.Y), float64(b.Y)))},
+	}
+	closest := vect.Float(math.Inf(1))
+	ps.query(bb, mask, func(shapeID uint64, shape *chipmunk.Shape) {
+		if t, hits := segmentHit(shape, a, b); hits && t < closest {
+			closest, id, ok = t, shapeID, true
+		}
+	})
+	if ok {
+		hitPoint := vect.Add(a, vect.Mult(vect.Sub(b, a), closest))
+		hit = engo.Point{X: float32(hitPoint.X), Y: float32(hitPoint.Y)}
+	}
+	return id, hit, ok
+}
+
+// query calls fn for every shape in the space whose bounding box overlaps bb and whose category is in mask,
+// along with the ID of the entity it belongs to, using the space's spatial index so that far away shapes are never looked at
+// Shapes whose bodies weren't added with an entity are skipped
+func (ps *PhysicsSystem) query(bb chipmunk.AABB, mask CollisionCategory, fn func(id uint64, shape *chipmunk.Shape)) {
+	ps.Space.Query(nil, bb, func(_, found chipmunk.Indexable) {
+		shape := found.Shape()
+		basic, ok := shape.Body.UserData.(*ecs.BasicEntity)
+		if !ok || (mask != 0 && shapeFilter(shape).category()&mask == 0) {
+			return
+		}
+		fn(basic.ID(), shape)
+	})
+}
+
+// around is the bounding box of the circle with centre p and radius r
+func around(p vect.Vect, r vect.Float) chipmunk.AABB {
+	return chipmunk.AABB{Lower: vect.Vect{X: p.X - r, Y: p.Y - r}, Upper: vect.Vect{X: p.X + r, Y: p.Y + r}}
+}
+
+// toWorld transforms v from shape's body coordinates to world coordinates
+func toWorld(shape *chipmunk.Shape, v vect.Vect) vect.Vect {
+	return vect.Add(shape.Body.Position(), rotate(v, shape.Body.Angle()))
+}
+
+// circleOf returns the centre and radius of shape in world coordinates, ok is false if it isn't a circle
+func circleOf(shape *chipmunk.Shape) (center vect.Vect, radius vect.Float, ok bool) {
+	if shape.ShapeType() != chipmunk.ShapeType_Circle {
+		return vect.Vect{}, 0, false
+	}
+	circle := shape.GetAsCircle()
+	return toWorld(shape, circle.Position), circle.Radius, true
+}
+
+// segmentOf returns the end points and radius of shape in world coordinates, ok is false if it isn't a segment
+func segmentOf(shape *chipmunk.Shape) (a, b vect.Vect, radius vect.Float, ok bool) {
+	if shape.ShapeType() != chipmunk.ShapeType_Segment {
+		return vect.Vect{}, vect.Vect{}, 0, false
+	}
+	segment := shape.GetAsSegment()
+	return toWorld(shape, segment.A), toWorld(shape, segment.B), segment.Radius, true
+}
+
+// polygonOf returns the vertices of shape in world coordinates, ok is false if it isn't a polygon or a box
+func polygonOf(shape *chipmunk.Shape) (verts []vect.Vect, ok bool) {
+	var poly *chipmunk.PolygonShape
+	switch shape.ShapeType() {
+	case chipmunk.ShapeType_Polygon:
+		poly = shape.GetAsPolygon()
+	case chipmunk.ShapeType_Box:
+		poly = shape.GetAsBox().Polygon
+	default:
+		return nil, false
+	}
+	verts = make([]vect.Vect, len(poly.Verts))
+	for i, v := range poly.Verts {
+		verts[i] = toWorld(shape, v)
+	}
+	return verts, true
+}
+
+// shapeDistance is the distance from p to the edge of shape, and 0 if p is inside it
+func shapeDistance(shape *chipmunk.Shape, p vect.Vect) vect.Float {
+	if center, radius, ok := circleOf(shape); ok {
+		return vect.Float(math.Max(0, float64(vect.Dist(p, center)-radius)))
+	}
+	if a, b, radius, ok := segmentOf(shape); ok {
+		return vect.Float(math.Max(0, float64(segmentDistance(p, a, b)-radius)))
+	}
+	if verts, ok := polygonOf(shape); ok {
+		if insidePolygon(p, verts) {
+			return 0
+		}
+		closest := vect.Float(math.Inf(1))
+		for i := range verts {
+			if d := segmentDistance(p, verts[i], verts[(i+1)%len(verts)]); d < closest {
+				closest = d
+			}
+		}
+		return closest
+	}
+	return vect.Float(math.Inf(1))
+}
+
+// segmentHit finds where the segment from a to b first hits shape, as a fraction t of the way from a to b
+func segmentHit(shape *chipmunk.Shape, a, b vect.Vect) (t vect.Float, hits bool) {
+	if center, radius, ok := circleOf(shape); ok {
+		return circleHit(center, radius, a, b)
+	}
+	if start, end, radius, ok := segmentOf(shape); ok {
+		if segmentDistance(a, start, end) <= radius {
+			return 0, true // We start inside the segment
+		}
+		// A segment with a radius is a rectangle with a circle on each end
+		t, hits = vect.Float(math.Inf(1)), false
+		offset := vect.Vect{}
+		if length := vect.Dist(start, end); length > 0 {
+			d := vect.Sub(end, start)
+			offset = vect.Vect{X: -d.Y * radius / length, Y: d.X * radius / length}
+		}
+		for _, edge := range [2][2]vect.Vect{
+			{vect.Add(start, offset), vect.Add(end, offset)},
+			{vect.Sub(start, offset), vect.Sub(end, offset)},
+		} {
+			if edgeT, ok := segmentsHit(a, b, edge[0], edge[1]); ok && edgeT < t {
+				t, hits = edgeT, true
+			}
+		}
+		if radius > 0 {
+			for _, center := range [2]vect.Vect{start, end} {
+				if capT, ok := circleHit(center, radius, a, b); ok && capT < t {
+					t, hits = capT, true
+				}
+			}
+		}
+		return t, hits
+	}
+	if verts, ok := polygonOf(shape); ok {
+		if insidePolygon(a, verts) {
+			return 0, true
+		}
+		t, hits = vect.Float(math.Inf(1)), false
+		for i := range verts {
+			if edgeT, ok := segmentsHit(a, b, verts[i], verts[(i+1)%len(verts)]); ok && edgeT < t {
+				t, hits = edgeT, true
+			}
+		}
+		return t, hits
+	}
+	return 0, false
+}
+
+// circleHit finds where the segment from a to b first hits the circle with centre center, like segmentHit
+func circleHit(center vect.Vect, radius vect.Float, a, b vect.Vect) (t vect.Float, hits bool) {
+	// Solve |a + t*d - center| = radius for the smallest t in [0, 1]
+	d := vect.Sub(b, a)
+	f := vect.Sub(a, center)
+	qa, qb, qc := float64(vect.Dot(d, d)), 2*float64(vect.Dot(f, d)), float64(vect.Dot(f, f)-radius*radius)
+	if qc <= 0 {
+		return 0, true // We start inside the circle
+	}
+	discriminant := qb*qb - 4*qa*qc
+	if qa == 0 || discriminant < 0 {
+		return 0, false
+	}
+	root := (-qb - math.Sqrt(discriminant)) / (2 * qa)
+	return vect.Float(root), root >= 0 && root <= 1
+}
+
+// segmentsHit finds where the segment from a to b crosses the segment from c to d, as a fraction t of the way from a to b
+func segmentsHit(a, b, c, d vect.Vect) (t vect.Float, hits bool) {
+	r, s := vect.Sub(b, a), vect.Sub(d, c)
+	denominator := cross(r, s)
+	if denominator == 0 {
+		return 0, false // Parallel, so any touching is along an edge we'll hit at one of its other edges
+	}
+	ac := vect.Sub(c, a)
+	t = cross(ac, s) / denominator
+	u := cross(ac, r) / denominator
+	return t, t >= 0 && t <= 1 && u >= 0 && u <= 1
+}
+
+// segmentDistance is the distance from p to the closest point on the segment from a to b
+func segmentDistance(p, a, b vect.Vect) vect.Float {
+	d := vect.Sub(b, a)
+	lengthSqr := vect.Dot(d, d)
+	if lengthSqr == 0 {
+		return vect.Dist(p, a)
+	}
+	t := vect.Float(math.Max(0, math.Min(1, float64(vect.Dot(vect.Sub(p, a), d)/lengthSqr))))
+	return vect.Dist(p, vect.Add(a, vect.Mult(d, t)))
+}
+
+// insidePolygon tells us if p is inside the polygon with vertices verts, which can be wound either way
+func insidePolygon(p vect.Vect, verts []vect.Vect) bool {
+	inside := false
+	for i, j := 0, len(verts)-1; i < len(verts); j, i = i, i+1 {
+		a, b := verts[i], verts[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) && p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// cross is the z component of the cross product of a and b
+func cross(a, b vect.Vect) vect.Float {
+	return a.X*b.Y - a.Y*b.X
+}
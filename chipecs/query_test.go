@@ -0,0 +1,140 @@
+package chipecs
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"engo.io/ecs"
+	"engo.io/engo"
+	"engo.io/engo/common"
+	"github.com/vova616/chipmunk"
+	"github.com/vova616/chipmunk/vect"
+)
+
+// queryScene is a space with a creature-like circle, a wall made of a box and a triangle, and a segment boundary
+type queryScene struct {
+	ps                     *PhysicsSystem
+	circle, wall, boundary ecs.BasicEntity
+	circlePhysics          PhysicsComponent
+	circleSpace            common.SpaceComponent
+}
+
+func newQueryScene() *queryScene {
+	s := &queryScene{ps: &PhysicsSystem{}, circle: ecs.NewBasic(), wall: ecs.NewBasic(), boundary: ecs.NewBasic()}
+	s.ps.New(nil)
+
+	// A circle of radius 10 centred on (100, 100)
+	body := chipmunk.NewBody(1, 1)
+	body.AddShape(chipmunk.NewCircle(vect.Vector_Zero, 10))
+	s.circlePhysics = PhysicsComponent{Shape: body.Shapes[0], CollisionFilter: CollisionFilter{Category: CategoryCreature}}
+	s.circleSpace = common.SpaceComponent{Position: engo.Point{X: 90, Y: 90}, Width: 20, Height: 20}
+	s.ps.Add(&s.circle, &s.circlePhysics, &s.circleSpace)
+
+	// A box covering (200, 0) to (240, 40), and a triangle with its right angle at (300, 0)
+	wall := chipmunk.NewBodyStatic()
+	wall.AddShape(chipmunk.NewBox(vect.Vect{X: 220, Y: 20}, 40, 40))
+	wall.AddShape(chipmunk.NewPolygon(chipmunk.Vertices{{X: 300, Y: 0}, {X: 300, Y: 40}, {X: 340, Y: 0}}, vect.Vector_Zero))
+	s.ps.AddStatic(&s.wall, wall, CollisionFilter{Category: CategoryWall})
+
+	// A vertical boundary along x = 500
+	boundary := chipmunk.NewBodyStatic()
+	boundary.AddShape(chipmunk.NewSegment(vect.Vect{X: 500, Y: 0}, vect.Vect{X: 500, Y: 500}, 0))
+	s.ps.AddStatic(&s.boundary, boundary, CollisionFilter{Category: CategoryWall})
+	return s
+}
+
+func TestPointQuery(t *testing.T) {
+	s := newQueryScene()
+	tests := []struct {
+		name string
+		p    engo.Point
+		mask CollisionCategory
+		want []uint64
+	}{
+		{"inside circle", engo.Point{X: 105, Y: 100}, 0, []uint64{s.circle.ID()}},
+		{"outside circle but inside its bounding box", engo.Point{X: 108, Y: 108}, 0, nil},
+		{"inside box", engo.Point{X: 210, Y: 30}, 0, []uint64{s.wall.ID()}},
+		{"inside triangle", engo.Point{X: 305, Y: 5}, 0, []uint64{s.wall.ID()}},
+		{"outside triangle but inside its bounding box", engo.Point{X: 335, Y: 35}, 0, nil},
+		{"masked out", engo.Point{X: 210, Y: 30}, CategoryCreature, nil},
+		{"empty", engo.Point{X: 400, Y: 400}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.ps.PointQuery(tt.p, tt.mask); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PointQuery(%v) = %v, want %v", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRadiusQuery(t *testing.T) {
+	s := newQueryScene()
+	// Reaches the circle, both of the wall's shapes (but the wall is only reported once) and the boundary
+	got := s.ps.RadiusQuery(engo.Point{X: 270, Y: 20}, 235, 0)
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	want := []uint64{s.circle.ID(), s.wall.ID(), s.boundary.ID()}
+	sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RadiusQuery = %v, want %v", got, want)
+	}
+
+	if got := s.ps.RadiusQuery(engo.Point{X: 270, Y: 20}, 30, 0); !reflect.DeepEqual(got, []uint64{s.wall.ID()}) {
+		t.Errorf("RadiusQuery between the box and triangle = %v, want only the wall", got)
+	}
+}
+
+func TestNearest(t *testing.T) {
+	s := newQueryScene()
+	tests := []struct {
+		name   string
+		p      engo.Point
+		max    float32
+		want   uint64
+		wantOK bool
+	}{
+		{"circle", engo.Point{X: 130, Y: 100}, 50, s.circle.ID(), true},
+		{"wall is closer than the circle", engo.Point{X: 180, Y: 20}, 100, s.wall.ID(), true},
+		{"boundary", engo.Point{X: 480, Y: 300}, 50, s.boundary.ID(), true},
+		{"too far", engo.Point{X: 400, Y: 400}, 50, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, ok := s.ps.Nearest(tt.p, tt.max, 0)
+			if id != tt.want || ok != tt.wantOK {
+				t.Errorf("Nearest(%v) = %v, %v, want %v, %v", tt.p, id, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRaycast(t *testing.T) {
+	s := newQueryScene()
+	tests := []struct {
+		name       string
+		start, end engo.Point
+		mask       CollisionCategory
+		want       uint64
+		wantHit    engo.Point
+		wantOK     bool
+	}{
+		{"circle first", engo.Point{X: 0, Y: 100}, engo.Point{X: 600, Y: 100}, 0, s.circle.ID(), engo.Point{X: 90, Y: 100}, true},
+		{"box", engo.Point{X: 150, Y: 20}, engo.Point{X: 600, Y: 20}, 0, s.wall.ID(), engo.Point{X: 200, Y: 20}, true},
+		{"triangle's slanted edge", engo.Point{X: 330, Y: 100}, engo.Point{X: 330, Y: 0}, 0, s.wall.ID(), engo.Point{X: 330, Y: 10}, true},
+		{"boundary behind masked out circle", engo.Point{X: 0, Y: 100}, engo.Point{X: 600, Y: 100}, CategoryWall, s.boundary.ID(), engo.Point{X: 500, Y: 100}, true},
+		{"miss", engo.Point{X: 0, Y: 300}, engo.Point{X: 400, Y: 300}, 0, 0, engo.Point{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, hit, ok := s.ps.Raycast(tt.start, tt.end, tt.mask)
+			if id != tt.want || ok != tt.wantOK {
+				t.Fatalf("Raycast = %v, %v, want %v, %v", id, ok, tt.want, tt.wantOK)
+			}
+			if math.Abs(float64(hit.X-tt.wantHit.X)) > 1e-3 || math.Abs(float64(hit.Y-tt.wantHit.Y)) > 1e-3 {
+				t.Errorf("Raycast hit %v, want %v", hit, tt.wantHit)
+			}
+		})
+	}
+}
@@ -2,26 +2,140 @@ package chipecs
 
 import (
 	"engo.io/ecs"
+	"engo.io/engo"
 	"engo.io/engo/common"
 	"github.com/vova616/chipmunk"
+	"github.com/vova616/chipmunk/vect"
 )
 
 // PhysicsSystem implements a basic system to manage the Chimunk physics engine
 // This type implements the engo.System interface
 type PhysicsSystem struct {
 	Space *chipmunk.Space
+	// Timestep is the fixed amount of time simulated by each step, in seconds, so that the
+	// simulation doesn't depend on the frame rate (defaults to 1/60)
+	Timestep float32
+	// Substeps is the number of equal parts each step is split into when stepping the space (defaults to 1)
+	Substeps int
+	// MaxSteps is the most steps that will be simulated in a single Update, so that we don't
+	// keep falling further behind after a lag spike (defaults to 5)
+	MaxSteps int
 
-	entities []physicsEntity
-	world    *ecs.World
+	entities    entityStore
+	world       *ecs.World
+	accumulator float32             // Time that has passed but hasn't been simulated yet
+	contacts    []ContactMessage    // Contacts that happened during the current step, dispatched once it's done
+	seen        map[contactKey]bool // So that we only report each contact once per step even if both bodies have callbacks
 }
 
 // PhysicsComponent holds physics data
 type PhysicsComponent struct {
 	Shape *chipmunk.Shape
+	// CollisionFilter decides which other shapes Shape collides with
+	CollisionFilter
+	// Sensor shapes report contacts with the shapes they overlap, but don't push them (or get pushed)
+	Sensor bool
+	// Group is a chipmunk collision group, shapes with the same non-zero Group never collide
+	Group int
+	// Render, if set, is moved to where the body is interpolated to be between the last two steps after
+	// every Update, so that it can be drawn smoothly while the SpaceComponent keeps the real position
+	Render *common.SpaceComponent
+}
+
+// CollisionCategory is a bit mask of categories of shapes
+type CollisionCategory uint32
+
+// Categories of shapes, these can be combined with bitwise or
+const (
+	CategoryCreature CollisionCategory = 1 << iota
+	CategoryWall
+	CategorySensor
+	CategoryCarcass
+	CategoryProjectile
+
+	// CategoryAll is every category
+	CategoryAll = ^CollisionCategory(0)
+)
+
+// CollisionFilter decides which shapes collide
+// Two shapes collide only if each one's Category is in the other's Mask
+// A zero Category or Mask is treated as CategoryAll, so that shapes collide with everything by default
+type CollisionFilter struct {
+	// Category is the categories a shape belongs to
+	Category CollisionCategory
+	// Mask is the categories a shape collides with
+	Mask CollisionCategory
+}
+
+// Collides tells us if shapes with filters f and other should collide
+func (f CollisionFilter) Collides(other CollisionFilter) bool {
+	return f.category()&other.mask() != 0 && other.category()&f.mask() != 0
+}
+
+func (f CollisionFilter) category() CollisionCategory {
+	if f.Category == 0 {
+		return CategoryAll
+	}
+	return f.Category
+}
+
+func (f CollisionFilter) mask() CollisionCategory {
+	if f.Mask == 0 {
+		return CategoryAll
+	}
+	return f.Mask
 }
 
 type physicsEntity struct {
 	*ecs.BasicEntity
 	*PhysicsComponent
 	*common.SpaceComponent
+
+	syncedPosition engo.Point // The Position we last wrote to SpaceComponent, if it's changed since then the entity was teleported
+	syncedRotation float32    // The Rotation we last wrote to SpaceComponent
+	prevPosition   vect.Vect  // Where the body was before the last step, for interpolating
+	prevAngle      vect.Float // The body's angle before the last step
+}
+
+// ContactPhase is whether two shapes have just started or just stopped touching
+type ContactPhase int
+
+const (
+	// ContactBegin means the shapes have just started touching
+	ContactBegin ContactPhase = iota
+	// ContactEnd means the shapes have just stopped touching
+	ContactEnd
+)
+
+// ContactMessage is dispatched on engo.Mailbox after every step of the space, once for
+// each pair of bodies that started or stopped touching during that step
+type ContactMessage struct {
+	// Entity is the entity that owns the first body, it's never nil
+	Entity *ecs.BasicEntity
+	// To is the entity that owns the second body, it's nil if the body doesn't belong
+	// to an entity in the PhysicsSystem
+	To    *ecs.BasicEntity
+	Phase ContactPhase
+	// Impulse is an estimate of the magnitude of the impulse the collision will apply to each body,
+	// which is the relative normal velocity times the reduced mass of the bodies (0 for ContactEnd)
+	Impulse float32
+	// Point is the first contact point in world coordinates (the zero point for ContactEnd)
+	Point engo.Point
+	// Normal is the contact normal pointing from Entity to To (the zero point for ContactEnd)
+	Normal engo.Point
+}
+
+// Type implements the engo.Message interface
+func (ContactMessage) Type() string { return "ContactMessage" }
+
+// SyncMessage is dispatched on engo.Mailbox at the end of every Update, once every SpaceComponent has caught up
+// with its body and before any ContactMessages, so that anything indexed by position can be refreshed first
+type SyncMessage struct{}
+
+// Type implements the engo.Message interface
+func (SyncMessage) Type() string { return "SyncMessage" }
+
+type contactKey struct {
+	a, b  *chipmunk.Body
+	phase ContactPhase
 }
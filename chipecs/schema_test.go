@@ -0,0 +1,30 @@
+package chipecs
+
+import "testing"
+
+func TestCollisionFilterCollides(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b CollisionFilter
+		want bool
+	}{
+		{"zero filters", CollisionFilter{}, CollisionFilter{}, true},
+		{"zero category is every category", CollisionFilter{}, CollisionFilter{Category: CategoryCreature, Mask: CategoryWall}, true},
+		{"zero mask is every category", CollisionFilter{Category: CategoryCreature}, CollisionFilter{Category: CategoryWall}, true},
+		{"in each other's masks", CollisionFilter{Category: CategoryCreature, Mask: CategoryWall}, CollisionFilter{Category: CategoryWall, Mask: CategoryCreature}, true},
+		{"only in one mask", CollisionFilter{Category: CategoryCreature, Mask: CategoryWall}, CollisionFilter{Category: CategoryWall, Mask: CategorySensor}, false},
+		{"masked out", CollisionFilter{Category: CategoryCreature, Mask: CategoryCreature}, CollisionFilter{Category: CategoryWall}, false},
+		{"one of several categories", CollisionFilter{Category: CategoryCreature | CategoryCarcass}, CollisionFilter{Category: CategoryWall, Mask: CategoryCarcass}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Whether two shapes collide shouldn't depend on which one we ask
+			if got := tt.a.Collides(tt.b); got != tt.want {
+				t.Errorf("a.Collides(b) = %v, want %v", got, tt.want)
+			}
+			if got := tt.b.Collides(tt.a); got != tt.want {
+				t.Errorf("b.Collides(a) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
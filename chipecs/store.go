@@ -0,0 +1,51 @@
+package chipecs
+
+// entityStore holds physicsEntities in a slice for fast iteration, along with an index
+// from entity ID to slice position so that adding, removing and looking up are all O(1)
+// Removal swaps the last entity into the removed entity's place, so order isn't preserved
+type entityStore struct {
+	entities []physicsEntity
+	index    map[uint64]int
+}
+
+func newEntityStore() entityStore {
+	return entityStore{index: make(map[uint64]int)}
+}
+
+// add adds e to the store, replacing any entity with the same ID
+func (s *entityStore) add(e physicsEntity) {
+	if i, exists := s.index[e.ID()]; exists {
+		s.entities[i] = e
+		return
+	}
+	s.index[e.ID()] = len(s.entities)
+	s.entities = append(s.entities, e)
+}
+
+// remove removes the entity with id from the store and returns it, ok is false if it wasn't there
+func (s *entityStore) remove(id uint64) (e physicsEntity, ok bool) {
+	i, ok := s.index[id]
+	if !ok {
+		return physicsEntity{}, false
+	}
+	e = s.entities[i]
+
+	last := len(s.entities) - 1
+	if i != last {
+		s.entities[i] = s.entities[last]
+		s.index[s.entities[i].ID()] = i
+	}
+	s.entities[last] = physicsEntity{} // Don't keep the removed entity alive through the backing array
+	s.entities = s.entities[:last]
+	delete(s.index, id)
+	return e, true
+}
+
+// get returns the entity with id, ok is false if it isn't in the store
+func (s *entityStore) get(id uint64) (e physicsEntity, ok bool) {
+	i, ok := s.index[id]
+	if !ok {
+		return physicsEntity{}, false
+	}
+	return s.entities[i], true
+}
@@ -0,0 +1,75 @@
+package chipecs
+
+import (
+	"testing"
+
+	"engo.io/ecs"
+)
+
+// checkStore makes sure that s holds exactly want, and that get finds each of them through the index
+func checkStore(t *testing.T, s *entityStore, want ...*ecs.BasicEntity) {
+	t.Helper()
+	if len(s.entities) != len(want) || len(s.index) != len(want) {
+		t.Fatalf("store has %d entities and %d indexed, want %d", len(s.entities), len(s.index), len(want))
+	}
+	for _, basic := range want {
+		e, ok := s.get(basic.ID())
+		if !ok || e.BasicEntity != basic {
+			t.Errorf("get(%d) = %v, %v, want the entity", basic.ID(), e.BasicEntity, ok)
+		}
+	}
+}
+
+func TestEntityStore(t *testing.T) {
+	basics := make([]ecs.BasicEntity, 4)
+	for i := range basics {
+		basics[i] = ecs.NewBasic()
+	}
+	a, b, c, d := &basics[0], &basics[1], &basics[2], &basics[3]
+
+	s := newEntityStore()
+	for _, basic := range []*ecs.BasicEntity{a, b, c, d} {
+		s.add(physicsEntity{BasicEntity: basic})
+	}
+	checkStore(t, &s, a, b, c, d)
+
+	// Removing the last entity doesn't have to move anything
+	if e, ok := s.remove(d.ID()); !ok || e.BasicEntity != d {
+		t.Fatalf("remove(last) = %v, %v, want the entity", e.BasicEntity, ok)
+	}
+	checkStore(t, &s, a, b, c)
+
+	// Removing from the middle swaps the last entity into its place
+	if e, ok := s.remove(a.ID()); !ok || e.BasicEntity != a {
+		t.Fatalf("remove(middle) = %v, %v, want the entity", e.BasicEntity, ok)
+	}
+	checkStore(t, &s, b, c)
+	if s.entities[0].BasicEntity != c {
+		t.Errorf("entities[0] = %d, want the last entity %d swapped into the hole", s.entities[0].ID(), c.ID())
+	}
+
+	// Removed entities are gone, and removing them again does nothing
+	if _, ok := s.get(a.ID()); ok {
+		t.Error("get found a removed entity")
+	}
+	if _, ok := s.remove(a.ID()); ok {
+		t.Error("removed an entity twice")
+	}
+	checkStore(t, &s, b, c)
+
+	// A removed ID can be added again, and adding an ID that's already there replaces it instead of duplicating it
+	s.add(physicsEntity{BasicEntity: a})
+	s.add(physicsEntity{BasicEntity: b, syncedRotation: 90})
+	checkStore(t, &s, a, b, c)
+	if e, _ := s.get(b.ID()); e.syncedRotation != 90 {
+		t.Error("adding an existing ID didn't replace it")
+	}
+
+	// Removing everything leaves an empty store
+	for _, basic := range []*ecs.BasicEntity{c, a, b} {
+		if _, ok := s.remove(basic.ID()); !ok {
+			t.Fatalf("couldn't remove %d", basic.ID())
+		}
+	}
+	checkStore(t, &s)
+}
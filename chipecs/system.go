@@ -2,6 +2,7 @@ package chipecs
 
 import (
 	"log"
+	"math"
 
 	"engo.io/ecs"
 	"engo.io/engo"
@@ -13,16 +14,8 @@ import (
 // Remove is called when an entity is removed from the world
 // so that this system knows that it's gone
 func (ps *PhysicsSystem) Remove(basic ecs.BasicEntity) {
-	delete := -1
-	for index, e := range ps.entities {
-		if e.BasicEntity.ID() == basic.ID() {
-			delete = index
-			ps.Space.RemoveBody(e.Shape.Body)
-			break
-		}
-	}
-	if delete >= 0 {
-		ps.entities = append(ps.entities[:delete], ps.entities[delete+1:]...)
+	if e, ok := ps.entities.remove(basic.ID()); ok {
+		ps.Space.RemoveBody(e.Shape.Body)
 	}
 }
 
@@ -32,20 +25,161 @@ func (ps *PhysicsSystem) New(*ecs.World) {
 	// Set up the spacce
 	ps.Space = chipmunk.NewSpace()
 	ps.Space.Gravity = vect.Vect{X: 0, Y: 0}
+	ps.seen = make(map[contactKey]bool)
+	ps.entities = newEntityStore()
+	if ps.Timestep <= 0 {
+		ps.Timestep = 1.0 / 60
+	}
+	if ps.Substeps <= 0 {
+		ps.Substeps = 1
+	}
+	if ps.MaxSteps <= 0 {
+		ps.MaxSteps = 5
+	}
 }
 
 // Update is called once every frame
 func (ps *PhysicsSystem) Update(dt float32) {
-	for _, e := range ps.entities {
-		pos := e.PhysicsComponent.Shape.Body.Position()
-		e.Position = engo.Point{X: float32(pos.X), Y: float32(pos.Y)}
-		e.Rotation = 0 // Engo rotates around the origin, not the center, so we don't want to set this
+	// Anything that's had its SpaceComponent moved since we last synced should have its body moved to match
+	for i := range ps.entities.entities {
+		e := &ps.entities.entities[i]
+		if e.Position != e.syncedPosition || e.Rotation != e.syncedRotation {
+			e.teleport()
+		}
+	}
+
+	for steps := ps.advance(dt); steps > 0; steps-- {
+		for i := range ps.entities.entities {
+			e := &ps.entities.entities[i]
+			e.prevPosition = e.Shape.Body.Position()
+			e.prevAngle = e.Shape.Body.Angle()
+		}
+		for i := 0; i < ps.Substeps; i++ {
+			ps.step(vect.Float(ps.Timestep / float32(ps.Substeps)))
+		}
 	}
-	ps.Space.Step(vect.Float(dt))
+
+	// SpaceComponent always follows the body exactly so that game logic sees the real state,
+	// only the optional Render copy is interpolated between the last two steps
+	alpha := vect.Float(ps.Alpha())
+	for i := range ps.entities.entities {
+		e := &ps.entities.entities[i]
+		pos, angle := e.Shape.Body.Position(), e.Shape.Body.Angle()
+		e.sync(pos, angle)
+		if e.Render != nil {
+			e.Render.Width, e.Render.Height = e.Width, e.Height
+			place(e.Render, vect.Add(vect.Mult(e.prevPosition, 1-alpha), vect.Mult(pos, alpha)), e.prevAngle*(1-alpha)+angle*alpha)
+		}
+	}
+	engo.Mailbox.Dispatch(SyncMessage{})
+	ps.dispatchContacts()
+}
+
+// advance adds dt to the time that hasn't been simulated yet, and returns how many fixed steps fit into it
+// The time for those steps is taken out of the accumulator, and the rest is left for later
+// If more than MaxSteps fit then we give up on catching up, and only keep whatever is left over after a whole number of steps
+func (ps *PhysicsSystem) advance(dt float32) (steps int) {
+	ps.accumulator += dt
+	for ps.accumulator >= ps.Timestep {
+		if steps == ps.MaxSteps {
+			ps.accumulator = float32(math.Mod(float64(ps.accumulator), float64(ps.Timestep)))
+			break
+		}
+		ps.accumulator -= ps.Timestep
+		steps++
+	}
+	return steps
+}
+
+// sync sets SpaceComponent so that its centre is at center and it's rotated by angle (in radians) about its centre
+func (e *physicsEntity) sync(center vect.Vect, angle vect.Float) {
+	place(e.SpaceComponent, center, angle)
+	e.syncedPosition, e.syncedRotation = e.Position, e.Rotation
+}
+
+// place sets space so that its centre is at center and it's rotated by angle (in radians) about its centre
+// Engo rotates around Position (the top left corner), so we have to offset Position to make up for it
+func place(space *common.SpaceComponent, center vect.Vect, angle vect.Float) {
+	offset := rotate(vect.Vect{X: vect.Float(space.Width / 2), Y: vect.Float(space.Height / 2)}, angle)
+	space.Position = engo.Point{X: float32(center.X - offset.X), Y: float32(center.Y - offset.Y)}
+	space.Rotation = float32(angle) * 180 / math.Pi
+}
+
+// teleport moves the body so that it matches SpaceComponent, without any interpolation
+func (e *physicsEntity) teleport() {
+	angle := vect.Float(e.Rotation * math.Pi / 180)
+	offset := rotate(vect.Vect{X: vect.Float(e.Width / 2), Y: vect.Float(e.Height / 2)}, angle)
+	center := vect.Vect{X: vect.Float(e.Position.X) + offset.X, Y: vect.Float(e.Position.Y) + offset.Y}
+	e.Shape.Body.SetPosition(center)
+	e.Shape.Body.SetAngle(angle)
+	e.prevPosition, e.prevAngle = center, angle
+	e.syncedPosition, e.syncedRotation = e.Position, e.Rotation
+	if e.Render != nil {
+		*e.Render = *e.SpaceComponent
+	}
+}
+
+// rotate rotates v by angle radians
+func rotate(v vect.Vect, angle vect.Float) vect.Vect {
+	sin, cos := math.Sincos(float64(angle))
+	return vect.Vect{
+		X: v.X*vect.Float(cos) - v.Y*vect.Float(sin),
+		Y: v.X*vect.Float(sin) + v.Y*vect.Float(cos),
+	}
+}
+
+// Alpha is how far we are between the last step and the next one, from 0 to 1
+// Update uses it to interpolate PhysicsComponent.Render between the previous and current state of each body
+func (ps *PhysicsSystem) Alpha() float32 {
+	return ps.accumulator / ps.Timestep
 }
 
 // Add adds a basic entity that has a physics and space component to the physics system
+// The body is moved to wherever the SpaceComponent is, and from then on they're kept in sync both ways:
+// after each Update SpaceComponent follows the body (and Render, if set, follows it smoothly), and writing to SpaceComponent's Position or Rotation
+// teleports the body on the next Update
 func (ps *PhysicsSystem) Add(basic *ecs.BasicEntity, physics *PhysicsComponent, space *common.SpaceComponent) {
-	ps.entities = append(ps.entities, physicsEntity{basic, physics, space})
+	e := physicsEntity{BasicEntity: basic, PhysicsComponent: physics, SpaceComponent: space}
+	e.teleport()
+	ps.entities.add(e)
+	physics.Shape.Body.UserData = basic // So that contacts can be traced back to their entities
+	physics.Shape.Body.CallbackHandler = contactHandler{ps}
+	physics.Shape.UserData = physics // So that contacts can be filtered
+	physics.Shape.IsSensor = physics.Sensor
+	physics.Shape.Group = chipmunk.Group(physics.Group)
 	ps.Space.AddBody(physics.Shape.Body)
 }
+
+// Get returns the PhysicsComponent of the entity basic, ok is false if basic isn't in the system
+func (ps *PhysicsSystem) Get(basic ecs.BasicEntity) (physics *PhysicsComponent, ok bool) {
+	return ps.GetByID(basic.ID())
+}
+
+// GetByID returns the PhysicsComponent of the entity with id, ok is false if it isn't in the system
+func (ps *PhysicsSystem) GetByID(id uint64) (physics *PhysicsComponent, ok bool) {
+	e, ok := ps.entities.get(id)
+	return e.PhysicsComponent, ok
+}
+
+// Each calls f for every entity in the system, in no particular order
+// f must not add or remove entities
+func (ps *PhysicsSystem) Each(f func(basic *ecs.BasicEntity, physics *PhysicsComponent, space *common.SpaceComponent)) {
+	for _, e := range ps.entities.entities {
+		f(e.BasicEntity, e.PhysicsComponent, e.SpaceComponent)
+	}
+}
+
+// Len returns the number of entities in the system
+func (ps *PhysicsSystem) Len() int {
+	return len(ps.entities.entities)
+}
+
+// AddStatic adds a static body, such as walls, owned by basic to the space, with filter applying to all of its shapes
+// Static bodies never move, so they don't show up in Each, but queries and ContactMessage.To do report basic
+func (ps *PhysicsSystem) AddStatic(basic *ecs.BasicEntity, body *chipmunk.Body, filter CollisionFilter) {
+	for _, shape := range body.Shapes {
+		shape.UserData = filter
+	}
+	body.UserData = basic
+	ps.Space.AddBody(body)
+}
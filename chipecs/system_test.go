@@ -0,0 +1,94 @@
+package chipecs
+
+import (
+	"math"
+	"testing"
+
+	"engo.io/ecs"
+	"engo.io/engo"
+	"engo.io/engo/common"
+	"github.com/vova616/chipmunk"
+	"github.com/vova616/chipmunk/vect"
+)
+
+// closeVect tells us if a and b are equal apart from float32 rounding
+func closeVect(a, b vect.Vect) bool {
+	return math.Abs(float64(a.X-b.X)) < 1e-3 && math.Abs(float64(a.Y-b.Y)) < 1e-3
+}
+
+func TestPlaceUnrotated(t *testing.T) {
+	space := common.SpaceComponent{Width: 40, Height: 20}
+	place(&space, vect.Vect{X: 100, Y: 50}, 0)
+	if space.Position != (engo.Point{X: 80, Y: 40}) || space.Rotation != 0 {
+		t.Errorf("place = %v rotated by %v, want (80, 40) rotated by 0", space.Position, space.Rotation)
+	}
+}
+
+func TestPlaceTeleportRoundTrip(t *testing.T) {
+	center := vect.Vect{X: 100, Y: 50}
+	for _, angle := range []vect.Float{0, math.Pi / 6, math.Pi / 2, math.Pi, -2} {
+		body := chipmunk.NewBody(1, 1)
+		body.AddShape(chipmunk.NewCircle(vect.Vector_Zero, 10))
+		basic := ecs.NewBasic()
+		space := common.SpaceComponent{Width: 40, Height: 20}
+		var render common.SpaceComponent
+		e := physicsEntity{
+			BasicEntity:      &basic,
+			PhysicsComponent: &PhysicsComponent{Shape: body.Shapes[0], Render: &render},
+			SpaceComponent:   &space,
+		}
+
+		place(&space, center, angle)
+		if got := float64(space.Rotation); math.Abs(got-float64(angle)*180/math.Pi) > 1e-3 {
+			t.Errorf("angle %v: Rotation = %v degrees, want %v", angle, got, float64(angle)*180/math.Pi)
+		}
+		// Engo rotates about Position, so the middle of the unrotated box ends up at Position plus the rotated half size
+		offset := rotate(vect.Vect{X: 20, Y: 10}, angle)
+		if got := vect.Add(vect.Vect{X: vect.Float(space.Position.X), Y: vect.Float(space.Position.Y)}, offset); !closeVect(got, center) {
+			t.Errorf("angle %v: SpaceComponent is centred on %v, want %v", angle, got, center)
+		}
+
+		// Teleporting from what place wrote should put the body back where it started
+		e.teleport()
+		if got := body.Position(); !closeVect(got, center) {
+			t.Errorf("angle %v: teleported body to %v, want %v", angle, got, center)
+		}
+		if got := body.Angle(); math.Abs(float64(got-angle)) > 1e-3 {
+			t.Errorf("angle %v: teleported body to angle %v", angle, got)
+		}
+		if e.syncedPosition != space.Position || e.syncedRotation != space.Rotation {
+			t.Errorf("angle %v: teleport didn't record the SpaceComponent it synced to", angle)
+		}
+		if render.Position != space.Position || render.Rotation != space.Rotation || render.Width != space.Width {
+			t.Errorf("angle %v: Render = %+v, want a copy of %+v", angle, render, space)
+		}
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	// Each update carries on from the accumulator the one before it left behind
+	ps := &PhysicsSystem{Timestep: 0.25, MaxSteps: 5}
+	tests := []struct {
+		name      string
+		dt        float32
+		wantSteps int
+		wantLeft  float32
+	}{
+		{"less than a step", 0.1, 0, 0.1},
+		{"leftover makes up a step", 0.2, 1, 0.05},
+		{"exactly a step", 0.25, 1, 0.05},
+		{"several steps", 0.6, 2, 0.15},
+		{"nothing", 0, 0, 0.15},
+		{"exactly MaxSteps", 1.1, 5, 0},
+		{"too far behind", 2.1, 5, 0.1}, // 1.25 of the 2.1 gets simulated, and of the 0.85 left only the part that isn't a whole step is kept
+	}
+	for _, tt := range tests {
+		steps := ps.advance(tt.dt)
+		if steps != tt.wantSteps || math.Abs(float64(ps.accumulator-tt.wantLeft)) > 1e-5 {
+			t.Errorf("%s: advance(%v) = %d steps leaving %v, want %d leaving %v", tt.name, tt.dt, steps, ps.accumulator, tt.wantSteps, tt.wantLeft)
+		}
+		if alpha := ps.Alpha(); math.Abs(float64(alpha-tt.wantLeft/ps.Timestep)) > 1e-4 || alpha < 0 || alpha >= 1 {
+			t.Errorf("%s: Alpha() = %v, want %v", tt.name, alpha, tt.wantLeft/ps.Timestep)
+		}
+	}
+}
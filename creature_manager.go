@@ -1,15 +1,16 @@
 package main
 
 import (
-	"image/color"
+	"fmt"
 	"log"
 	"math"
 	"math/rand"
+	"runtime"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/pietroglyph/gevo/chipecs"
-	"github.com/pietroglyph/gevo/util"
 	"github.com/vova616/chipmunk"
 	"github.com/vova616/chipmunk/vect"
 
@@ -19,20 +20,55 @@ import (
 )
 
 var (
-	networkInputs                  = []string{"angle", "storedfood", "vision", "const"}
-	networkOutputs                 = []string{"velocitydelta", "angle", "eat", "mate"}
-	hiddenLayerCount               = len(networkInputs) + len(networkOutputs)
+	networkInputs                  = []string{"angle", "storedfood", "vision", "age", "nearby", "const"}
+	networkOutputs                 = []string{"thrust", "turn", "eat", "mate", "attack", "divide"}
+	inputIndex                     = indexNames(networkInputs)  // Where each input is in BrainComponent.Input
+	outputIndex                    = indexNames(networkOutputs) // Where each output is in BrainComponent.Output
 	creatureSizeMultiplier float32 = 10.0
 	massMultiplier         float32 = 5
 	baseFoodCost           float32 = 0.14
-	movementFoodCost       float32 = 0.12
-	angleFoodCost          float32 = 0.04
+	movementFoodCost       float32 = 0.06 // Food used per unit of velocity change from thrusting
+	angleFoodCost          float32 = 0.4  // Food used per unit of angular velocity change from turning
+	linearDrag             float32 = 1    // Fraction of a creature's velocity that it loses per second to drag
+	angularDrag            float32 = 2    // Fraction of a creature's angular velocity that it loses per second to drag
 	eatFoodCost            float32 = 0.1
+	attackFoodCost         float32 = 0.05
+	attackThreshold        float32 = 5     // The "attack" output has to be above this for a collision to be an attack
+	attackDamage           float32 = 0.02  // Food taken from the victim per unit of relative speed, scaled by the attacker's size over the victim's
+	predationEfficiency    float32 = 0.6   // Fraction of the food taken from the victim that the attacker actually gets
+	carcassFoodFraction    float32 = 0.8   // Fraction of a dead creature's remaining food that is left on the tile it died on
+	asexualReproduction            = false // Whether creatures can use their "divide" output to split into themselves and a mutated clone
+	divideThreshold        float32 = 5     // The "divide" output has to be above this for a creature to divide
+	divideMinFood          float32 = 6     // A creature needs at least this much StoredFood to divide, half of which goes to the clone
+	newbornFood            float32 = 8     // StoredFood that spawned creatures and the children of mating start with
+	maxLifespan                    = 0     // Creatures die of old age once they're this many ticks old, 0 means they never do
+	senescenceAge                  = 1000  // Age in ticks at which senescenceFoodCost is charged in full, it scales linearly with age
+	senescenceFoodCost     float32 = 0.05  // Extra food used per tick by a creature that is senescenceAge ticks old
 	deadlyTileFoodCost     float32 = 0.4
-	wg                     sync.WaitGroup
+	mutationRate           float32 = 0.1           // Probability that any one inherited weight gets mutated
+	mutationStrength       float64 = 0.2           // Standard deviation of the normally distributed amount added to a mutated weight
+	mateChance             float64 = 0.01          // Probability that two genetically identical creatures mate when they collide
+	mateCompatibility              = "exponential" // How the chance of mating falls off with genome distance, one of "none", "linear" or "exponential"
+	mateCompatibilityScale float64 = 0.5           // Genome distance at which mating becomes impossible (linear) or 1/e as likely (exponential)
+	randomSeed             int64                   // Seed for the random number generator, 0 means one is picked from the current time
+	nearbyRange            float32 = 100           // Distance from a creature's edge within which other creatures count towards its "nearby" input
+	brainWorkers                   = 0             // Number of goroutines that evaluate brains in parallel, 0 means one per CPU
+	brainBatchSize                 = 128           // Number of creatures each brain worker evaluates at a time
+	batchedBrains                  = true          // Whether to evaluate brains packed into matrices instead of one creature at a time
 	elapsedTime            int
 )
 
+// Causes of death that get reported in CreatureDeathMessage
+const (
+	causeStarvation = "starvation" // Ran out of food
+	causeDrowning   = "drowning"   // Ran out of food while on a deadly tile
+	causePredation  = "predation"  // Killed by another creature's attack
+	causeOldAge     = "oldage"     // Reached maxLifespan
+)
+
+// deathCauses is every cause of death that we know about, in the order they should be reported
+var deathCauses = []string{causeStarvation, causeDrowning, causePredation, causeOldAge}
+
 // Creature is an entity upon which evolution is simulated
 // Creatures can collide, have a size, and something to render,
 // and also have a "brain" which is a very simple 2-layer feedforward neural network.
@@ -44,7 +80,23 @@ type Creature struct {
 	chipecs.PhysicsComponent
 	// BrainComponent contains a simple feedforward neural network
 	BrainComponent
-	StoredFood float32
+	// TraitComponent holds heritable traits other than the brain
+	TraitComponent
+	// EnergyComponent holds our StoredFood and accounts for how it changes
+	EnergyComponent
+	// BirthTick is the value of CreatureManagerSystem.Tick when this creature was spawned
+	BirthTick int
+	// Age is the number of ticks this creature has been alive for
+	Age int
+	// Parents holds the IDs of the creatures this creature was born from, it's empty if it was spawned in
+	Parents []uint64
+	// Generation is one more than the highest generation of our parents, and 0 for spawned creatures
+	Generation int
+	// SpeciesID is the species this creature was last clustered into by SpeciationSystem
+	SpeciesID int
+
+	killedBy    string                // Cause of death set outside of Update, empty if nothing has killed us yet
+	renderSpace common.SpaceComponent // Where we're drawn, which the PhysicsSystem interpolates between steps
 }
 
 // Neuron has a single value field, and is meant to be used as an input
@@ -64,12 +116,31 @@ type Axon struct {
 
 // BrainComponent contains a simple 2-layer feedforward neural network
 type BrainComponent struct {
-	// Input is a map of unweighted values
-	Input map[string]Neuron
-	// HiddenLayer is a map of weighted values, the key corresponds to an Input key
+	// Input holds unweighted values, in the same order as networkInputs
+	Input []Neuron
+	// HiddenLayer holds weighted values, each one is fed by every Input
 	HiddenLayer []Axon
-	// Output is a map of weighted values, the key corresponds to a HiddenLayer key
-	Output map[string]Axon
+	// Output holds weighted values, in the same order as networkOutputs, each one is fed by the whole HiddenLayer
+	Output []Axon
+}
+
+// input returns the Input neuron called name
+func (b *BrainComponent) input(name string) *Neuron {
+	return &b.Input[inputIndex[name]]
+}
+
+// output returns the Output axon called name
+func (b *BrainComponent) output(name string) *Axon {
+	return &b.Output[outputIndex[name]]
+}
+
+// indexNames maps each of names to its position in names
+func indexNames(names []string) map[string]int {
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
+	}
+	return index
 }
 
 // CreatureManagerSystem satisfies interface ecs.System
@@ -82,114 +153,265 @@ type CreatureManagerSystem struct {
 	MapScene *MapScene
 	// World is used to keep track of game's world because we need it in update
 	World *ecs.World
+	// Tick is the number of times Update has been called
+	Tick int
+	// Lineage records the ancestry of every creature that has ever been managed by this system
+	Lineage *lineageStore
+
+	physics       *chipecs.PhysicsSystem // The physics system in the same world, if there is one
+	spawnClusters []engo.Point           // Centres used by the "clustered" spawn strategy
+	brains        brainBatches           // Reused between ticks when batchedBrains is set
+	hash          *creatureHash          // Where every creature was when physics last synced, for finding creatures near a point
+	rng           *rand.Rand             // Where every random number in the simulation comes from, seeded from randomSeed so that runs can be repeated
 }
 
-func (c *Creature) think(ms *MapScene) {
-	defer wg.Done() // Decrement the WaitGroup when we're done
-
-	// Populate Input
-	for key := range c.BrainComponent.Input {
-		// We do this because doing c.BrainComponent.Input[key].Value is a double assignment if key doesn't exits, which Go doesn't allow
-		var val = c.BrainComponent.Input[key] // We're making a copy here where we first assume that key exists
+// sense populates our Input layer from the world
+// It reads the tiles, the spatial hash and our physics body, so it has to be run from the same goroutine as the rest of the game
+func (c *Creature) sense(cm *CreatureManagerSystem) {
+	for i, key := range networkInputs {
+		val := &c.BrainComponent.Input[i]
 		switch key {
 		case "angle":
 			val.Value = float32(c.Shape.Body.Angle())
 		case "storedfood":
 			val.Value = c.StoredFood
+		case "age":
+			val.Value = float32(c.Age) / float32(senescenceAge) // Scaled so that it's comparable to the other inputs
 		case "vision":
-			val.Value = ms.getTileEntityAt(c.Position).foodStored
+			val.Value = cm.MapScene.getTileEntityAt(c.Center()).foodStored
+		case "nearby":
+			val.Value = 0
+			cm.hash.overlapping(c.Center(), c.Width/2+nearbyRange, func(other *Creature) {
+				if other != c {
+					val.Value++
+				}
+			})
 		case "const":
 			val.Value = 1
 		}
-		c.BrainComponent.Input[key] = val
 	}
+}
 
+// think evaluates our network from the Input layer that sense populated
+// It only touches this creature's brain, so creatures can think in parallel as long as nothing else is running
+// Neurons are always summed in the same order so that brainBatches can give exactly the same results
+func (c *Creature) think() {
 	// Populate HiddenLayer
 	for i := range c.BrainComponent.HiddenLayer {
 		var wSum float32
 		// Find the weighted sum of the Input layer
-		for key := range c.BrainComponent.Input {
-			wSum += c.BrainComponent.Input[key].Value * c.BrainComponent.HiddenLayer[i].Weight
+		for _, in := range c.BrainComponent.Input {
+			wSum += in.Value * c.BrainComponent.HiddenLayer[i].Weight
 		}
 		c.BrainComponent.HiddenLayer[i].Value = wSum
 	}
 
 	// Populate Output
-	for key := range c.BrainComponent.Output {
+	for k := range c.BrainComponent.Output {
 		var wSum float32
 		// Find the weighted sum of the HiddenLayer
 		for i := range c.BrainComponent.HiddenLayer {
-			wSum += c.BrainComponent.HiddenLayer[i].Value * c.BrainComponent.Output[key].Weight
+			wSum += c.BrainComponent.HiddenLayer[i].Value * c.BrainComponent.Output[k].Weight
 		}
-		// See the first loop for why we do this
-		var val = c.BrainComponent.Output[key]
-		val.Value = wSum
-		c.BrainComponent.Output[key] = val
+		c.BrainComponent.Output[k].Value = wSum
+	}
+}
+
+// thinkAll runs think for every creature on a pool of brainWorkers goroutines, each taking brainBatchSize creatures at a time
+// All of the inputs must already have been sensed, and nothing else may touch the creatures until it returns
+func thinkAll(creatures []*Creature) {
+	parallelBatches(len(creatures), func(start, end int) {
+		for _, c := range creatures[start:end] {
+			c.think()
+		}
+	})
+}
+
+// parallelBatches splits [0, n) into batches of brainBatchSize and calls fn on each of them from a pool of brainWorkers goroutines
+// It returns once every batch is done, so fn must only touch the part of its data that's in its batch
+func parallelBatches(n int, fn func(start, end int)) {
+	workers := brainWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	batchSize := brainBatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	batches := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range batches {
+				end := start + batchSize
+				if end > n {
+					end = n
+				}
+				fn(start, end)
+			}
+		}()
+	}
+	for start := 0; start < n; start += batchSize {
+		batches <- start
+	}
+	close(batches)
+	wg.Wait()
+}
+
+// sortedCreatures returns every creature in ascending order of ID, so that we always update them in the same order
+func (cm *CreatureManagerSystem) sortedCreatures() []*Creature {
+	creatures := make([]*Creature, 0, len(cm.Creatures))
+	for _, c := range cm.Creatures {
+		creatures = append(creatures, c)
 	}
-	return
+	sort.Slice(creatures, func(i, j int) bool { return creatures[i].ID() < creatures[j].ID() })
+	return creatures
 }
 
 // Remove is called when an entity is removed
 func (cm *CreatureManagerSystem) Remove(e ecs.BasicEntity) {
+	if c, ok := cm.Creatures[e.ID()]; ok && cm.hash != nil {
+		cm.hash.remove(c) // So that the dead don't block spawns or get sensed
+	}
 	delete(cm.Creatures, e.ID())
 }
 
+// rebuildHash refills the spatial hash from where every creature is now
+func (cm *CreatureManagerSystem) rebuildHash() {
+	if cm.hash == nil {
+		cm.hash = newCreatureHash(cm.MapScene.bounds(), creatureHashCellSize)
+	}
+	cm.hash.clear()
+	for _, c := range cm.Creatures { // The order creatures are found in doesn't matter, so we don't need to sort them
+		cm.hash.insert(c)
+	}
+}
+
 // Update is called every frame
 func (cm *CreatureManagerSystem) Update(dt float32) {
-	if len(cm.Creatures) < cm.MinCreatures {
-		for len(cm.Creatures) < cm.MinCreatures {
-			cm.spawnCreature()
+	cm.Tick++
+
+	// The PhysicsSystem tells us to rebuild the spatial hash whenever it moves things, so we only have to if there isn't one
+	if cm.hash == nil || cm.physics == nil {
+		cm.rebuildHash()
+	}
+
+	for len(cm.Creatures) < cm.MinCreatures {
+		if cm.spawnCreature(newbornFood) == nil {
+			break // The map is too full, we'll try again next tick
 		}
 	}
 
-	for _, v := range cm.Creatures {
-		wg.Add(1)
-		go v.think(cm.MapScene)
+	// Sense everything first so that the parallel part doesn't touch anything shared
+	creatures := cm.sortedCreatures()
+	for _, v := range creatures {
+		v.sense(cm)
 	}
-	wg.Wait()
+	if batchedBrains {
+		cm.brains.think(creatures)
+	} else {
+		thinkAll(creatures)
+	}
+
+	for _, v := range creatures {
+		v.Age++
 
-	for _, v := range cm.Creatures {
 		// Use food for everything that's being done, and add food as well
-		v.StoredFood -= v.Output["angle"].Value * angleFoodCost
-		v.StoredFood -= v.Output["movementdelta"].Value * movementFoodCost
-		v.StoredFood -= baseFoodCost
+		v.spend(energyBase, baseFoodCost)
+		v.spend(energySenescence, senescenceFoodCost*float32(v.Age)/float32(senescenceAge))
+		v.spend(energyTraits, v.TraitComponent.metabolicCost())
 		tileUnder := cm.MapScene.getTileEntityAt(v.SpaceComponent.Center())
 		if tileUnder.deadly {
-			v.StoredFood -= deadlyTileFoodCost
+			v.spend(energyDeadlyTile, deadlyTileFoodCost)
 		}
-		if v.Output["eat"].Value > 0 {
-			v.StoredFood -= v.Output["eat"].Value * eatFoodCost
-			v.StoredFood += float32(tileUnder.foodStored)
+		v.spend(energyAttacking, positive(v.output("attack").Value)*attackFoodCost)
+		if v.output("eat").Value > 0 {
+			v.spend(energyEating, v.output("eat").Value*eatFoodCost)
+			v.gain(energyPlants, tileUnder.foodStored*v.plantEfficiency())
+			v.gain(energyCarcasses, tileUnder.carcassFood*v.meatEfficiency())
+			tileUnder.carcassFood = 0 // Unlike plants, carcasses get used up
 		}
-		if v.StoredFood < 0.3 {
-			cm.World.RemoveEntity(v.BasicEntity)
+
+		// Work out how hard we're thrusting and turning, and pay for the velocity change that will cause
+		thrust, torque := v.locomotion()
+		mass := float32(v.Shape.Body.Mass())
+		moment := float32(v.Shape.Moment(mass))
+		v.spend(energyMovement, float32(math.Abs(float64(thrust)))/mass*dt*movementFoodCost)
+		v.spend(energyTurning, float32(math.Abs(float64(torque)))/moment*dt*angleFoodCost)
+
+		if maxLifespan > 0 && v.Age >= maxLifespan {
+			cm.removeCreature(v, causeOldAge)
 			continue
 		}
-		diameter := v.StoredFood * creatureSizeMultiplier
+		if v.starving() {
+			cause := v.killedBy
+			if cause == "" && tileUnder.deadly {
+				cause = causeDrowning
+			} else if cause == "" {
+				cause = causeStarvation
+			}
+			cm.removeCreature(v, cause)
+			continue
+		}
+		v.killedBy = "" // We survived whatever attacked us, so it isn't to blame if we die later
+		if asexualReproduction && v.output("divide").Value > divideThreshold && v.StoredFood >= divideMinFood {
+			// Half of our food goes to the clone, so we only give it up if there was room to spawn it
+			if clone := cm.spawnCreature(v.StoredFood/2, v); clone != nil {
+				v.spend(energyDivision, clone.StoredFood)
+			}
+		}
+		v.endTick()
+
+		diameter := v.StoredFood * creatureSizeMultiplier * v.BaseSize
 		v.Width = diameter
 		v.Height = diameter
 		v.Shape.GetAsCircle().Radius = vect.Float(v.Width / 2)
 		v.Shape.Body.SetMass(calculateMass(diameter))
 		v.Shape.Body.SetMoment(v.Shape.Moment(float32(calculateMass(diameter))))
 
-		// Update the current position and angle based on the angle and position delta
-		v.Shape.Body.SetAngle(vect.Float(v.Output["angle"].Value))
-		velDelta := engo.Point{}
-		velDelta.X = float32(math.Sin(float64(v.Output["angle"].Value))) * (v.Output["velocitydelta"].Value)
-		velDelta.Y = float32(math.Cos(float64(v.Output["angle"].Value))) * (v.Output["velocitydelta"].Value)
-		v.Shape.Body.AddVelocity(velDelta.X, velDelta.Y)
+		// Move by applying forces to the body (recalculated now that our mass has changed) and let the physics engine do the rest
+		// Drag is what stops us from going faster than our MaxSpeed or turning faster than our TurnRate
+		thrust, torque = v.locomotion()
+		angle := float64(v.Shape.Body.Angle())
+		vel := v.Shape.Body.Velocity()
+		mass = float32(v.Shape.Body.Mass())
+		moment = float32(v.Shape.Moment(mass))
+		v.Shape.Body.SetForce(
+			float32(math.Sin(angle))*thrust-float32(vel.X)*linearDrag*mass,
+			float32(math.Cos(angle))*thrust-float32(vel.Y)*linearDrag*mass,
+		)
+		v.Shape.Body.SetTorque(torque - v.Shape.Body.AngularVelocity()*angularDrag*moment)
 	}
 }
 
 // New is called when CreatureManagerSystem is added to the scene
 func (cm *CreatureManagerSystem) New(World *ecs.World) {
-	cm.World = World                          // So we can access World in cm.Update
-	rand.Seed(time.Now().UnixNano())          // Use the current Unix time as a seed for our random numbers
+	cm.World = World // So we can access World in cm.Update
+	seed := randomSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano() // Use the current Unix time as a seed for our random numbers
+	}
+	cm.rng = rand.New(rand.NewSource(seed))
+	log.Println("Random seed is", seed)
 	cm.Creatures = make(map[uint64]*Creature) // Make the Creatures map
+	cm.Lineage = newLineageStore()
+	for _, system := range World.Systems() {
+		if sys, ok := system.(*chipecs.PhysicsSystem); ok {
+			cm.physics = sys
+		}
+	}
+
+	// Refresh the spatial hash as soon as bodies have moved, so that contacts and everything after them see where creatures are now
+	engo.Mailbox.Listen("SyncMessage", func(engo.Message) {
+		cm.rebuildHash()
+	})
 
-	engo.Mailbox.Listen("CollisionMessage", func(message engo.Message) {
-		m, ok := message.(common.CollisionMessage)
-		if !ok {
+	engo.Mailbox.Listen("ContactMessage", func(message engo.Message) {
+		m, ok := message.(chipecs.ContactMessage)
+		if !ok || m.Phase != chipecs.ContactBegin || m.To == nil {
 			return
 		}
 
@@ -198,98 +420,160 @@ func (cm *CreatureManagerSystem) New(World *ecs.World) {
 		if !fromExists || !toExists {
 			return
 		}
-		if cm.Creatures[m.Entity.ID()].Output["mate"].Value > 5 && cm.Creatures[m.To.ID()].Output["mate"].Value > 5 {
-			if rand.Float64() < 0.99 {
+		if cm.Creatures[m.Entity.ID()].output("mate").Value > 5 && cm.Creatures[m.To.ID()].output("mate").Value > 5 {
+			if cm.rng.Float64() >= mateChance*mateCompatibilityChance(cm.Creatures[m.Entity.ID()], cm.Creatures[m.To.ID()]) {
 				return
 			}
-			cm.spawnCreature() // TODO: Add genetic inheritance
+			cm.spawnCreature(newbornFood, cm.Creatures[m.Entity.ID()], cm.Creatures[m.To.ID()])
 		} else {
-			if cm.Creatures[m.Entity.ID()].StoredFood > cm.Creatures[m.To.ID()].StoredFood {
-				cm.Creatures[m.To.ID()].StoredFood -= cm.Creatures[m.To.ID()].StoredFood
-			}
+			// Either creature (or both) can be the attacker
+			cm.attack(cm.Creatures[m.Entity.ID()], cm.Creatures[m.To.ID()])
+			cm.attack(cm.Creatures[m.To.ID()], cm.Creatures[m.Entity.ID()])
 		}
 	})
 	log.Println("CreatureManagerSystem was added to the scene.")
 }
 
-func (cm *CreatureManagerSystem) spawnCreature() {
-	rand.Seed(time.Now().UnixNano())
-	creature := &Creature{BasicEntity: ecs.NewBasic()}
+// locomotion works out the thrust force and torque a creature wants to apply from its outputs
+// The most a creature can apply is whatever would make drag balance out at its MaxSpeed and TurnRate
+func (c *Creature) locomotion() (thrust, torque float32) {
+	mass := float32(c.Shape.Body.Mass())
+	moment := float32(c.Shape.Moment(mass))
+	thrust = clampTrait(c.output("thrust").Value, -1, 1) * c.MaxSpeed * linearDrag * mass
+	torque = clampTrait(c.output("turn").Value, -1, 1) * c.TurnRate * angularDrag * moment
+	return thrust, torque
+}
+
+// attack makes attacker take food from victim if attacker wants to attack
+// Damage goes up with the attacker's size relative to the victim, and with how fast they collided
+// Whatever the attacker doesn't manage to get is spilled onto the victim's tile as a carcass
+func (cm *CreatureManagerSystem) attack(attacker, victim *Creature) {
+	if attacker.output("attack").Value <= attackThreshold {
+		return
+	}
+
+	relativeVelocity := vect.Sub(attacker.Shape.Body.Velocity(), victim.Shape.Body.Velocity())
+	damage := attackDamage * (attacker.Width / victim.Width) * float32(vect.Length(relativeVelocity))
+	if damage > victim.StoredFood {
+		damage = victim.StoredFood
+	}
+	victim.spend(energyPredated, damage)
+	attacker.gain(energyPredation, damage*predationEfficiency*attacker.meatEfficiency())
+	if tile := cm.MapScene.getTileEntityAt(victim.SpaceComponent.Center()); !tile.deadly {
+		tile.carcassFood += damage * (1 - predationEfficiency) * carcassFoodFraction
+	}
+	if victim.StoredFood < 0.3 {
+		victim.killedBy = causePredation
+	}
+}
 
-	// Make BrainComponent maps
-	creature.BrainComponent.Input = make(map[string]Neuron)
-	creature.BrainComponent.Output = make(map[string]Axon)
+// removeCreature removes c from the world and reports why it died
+// Whatever food c had left is partially left behind as a carcass on the tile it died on
+func (cm *CreatureManagerSystem) removeCreature(c *Creature, cause string) {
+	if tile := cm.MapScene.getTileEntityAt(c.SpaceComponent.Center()); !tile.deadly && c.StoredFood > 0 {
+		tile.carcassFood += c.StoredFood * carcassFoodFraction
+	}
+	cm.World.RemoveEntity(c.BasicEntity)
+	engo.Mailbox.Dispatch(CreatureDeathMessage{
+		Creature:  c,
+		Cause:     cause,
+		Age:       c.Age,
+		FoodEaten: c.foodEaten(),
+	})
+	cm.Lineage.markDead(c.ID(), cm.Tick)
+}
 
-	// Initalize select inputs
-	creature.StoredFood = 8
-	creature.BrainComponent.Input["food"] = Neuron{Value: creature.StoredFood}
-	creature.BrainComponent.Input["const"] = Neuron{Value: float32(1.0)}
+// spawnCreature adds a new creature with storedFood to the world and returns it
+// If parents are given then the creature inherits its brain from them, otherwise its brain is random
+// A single parent produces a mutated clone
+// It returns nil if there isn't anywhere to put the creature without it overlapping something
+func (cm *CreatureManagerSystem) spawnCreature(storedFood float32, parents ...*Creature) *Creature {
+	creature := &Creature{BasicEntity: ecs.NewBasic(), BirthTick: cm.Tick}
+	for _, p := range parents {
+		creature.Parents = append(creature.Parents, p.ID())
+		if p.Generation+1 > creature.Generation {
+			creature.Generation = p.Generation + 1
+		}
+	}
+
+	// Make BrainComponent layers
+	creature.BrainComponent.Input = make([]Neuron, len(networkInputs))
+	creature.BrainComponent.Output = make([]Axon, len(networkOutputs))
+
+	// Initalize the inputs that we know before sensing anything
+	creature.StoredFood = storedFood // Set before we work out our size and mass from it
+	creature.input("storedfood").Value = creature.StoredFood
+	creature.input("const").Value = 1
 
 	// We don't touch Value because that gets set after spawning
 
 	// Outputs
-	for i := range networkOutputs {
-		creature.BrainComponent.Output[networkOutputs[i]] = Axon{Weight: rand.Float32()}
+	for i := range creature.BrainComponent.Output {
+		creature.BrainComponent.Output[i] = Axon{Weight: cm.rng.Float32()}
 	}
 
-	// HiddenLayer (we do > because slices have 0 as an index)
-	for i := 0; i > hiddenLayerCount; i++ {
-		creature.BrainComponent.HiddenLayer[i] = Axon{Weight: rand.Float32()}
+	// HiddenLayer has a neuron for every input and output, so every creature has the same topology
+	hiddenLayerCount := len(networkInputs) + len(networkOutputs)
+	creature.BrainComponent.HiddenLayer = make([]Axon, hiddenLayerCount, hiddenLayerCount+1)
+	for i := range creature.BrainComponent.HiddenLayer {
+		creature.BrainComponent.HiddenLayer[i] = Axon{Weight: cm.rng.Float32()}
 	}
 
-	// For adding a const neuron
-	hiddenLayerCount++
-
 	// Const neuron
 	creature.BrainComponent.HiddenLayer = append(creature.BrainComponent.HiddenLayer, Axon{Weight: 1, Value: 0})
 
-	bounds := engo.Point{X: float32(cm.MapScene.levelData.Width() * cm.MapScene.levelData.TileWidth), Y: float32(cm.MapScene.levelData.Height() * cm.MapScene.levelData.TileHeight)}
+	if len(parents) > 0 {
+		creature.BrainComponent.inherit(cm.rng, parents)
+		creature.TraitComponent = inheritTraits(cm.rng, parents)
+	} else {
+		creature.TraitComponent = randomTraits(cm.rng)
+	}
 
 	// For calculating size based on food
-	diameter := creature.StoredFood * creatureSizeMultiplier
+	diameter := creature.StoredFood * creatureSizeMultiplier * creature.BaseSize
 
-	// Make creature size based on amount of stored food and put the creature at 0, 0 (we'll get a random position later)
-	creature.SpaceComponent = common.SpaceComponent{
-		Position: engo.Point{X: rand.Float32(), Y: rand.Float32()},
-		Width:    diameter,
-		Height:   diameter,
+	// Find somewhere to put the creature that doesn't overlap with walls, water or other creatures
+	strategy := spawnPlacement
+	if len(parents) > 0 {
+		strategy = birthPlacement
 	}
-
-	// This stops overlap but pushes creatures to the center... FIXME?
-	if creature.SpaceComponent.Position.X < 0.5 { // If we're closer to the left and top walls then make sure the creatures aren't colliding with the walls
-		creature.SpaceComponent.Position.X *= bounds.X                                 // Regular World bounds
-		creature.SpaceComponent.Position.X += float32(cm.MapScene.levelData.TileWidth) // Make sure we don't intersect with the top or left walls
-	} else { // Same but for the bottom and right walls (and the middle)
-		creature.SpaceComponent.Position.X *= bounds.X - float32(cm.MapScene.levelData.TileWidth) - diameter // Make sure we can't intersect with the bottom or right walls
+	center, ok := cm.findSpawnPoint(strategy, parents, diameter/2)
+	if !ok {
+		return nil
 	}
 
-	if creature.SpaceComponent.Position.Y < 0.5 { // If we're closer to the left and top walls then make sure the creatures aren't colliding with the walls
-		creature.SpaceComponent.Position.Y *= bounds.Y                                  // Regular World bounds
-		creature.SpaceComponent.Position.Y += float32(cm.MapScene.levelData.TileHeight) // Make sure we don't intersect with the top or left walls
-	} else { // Same but for the bottom and right walls (and the middle)
-		creature.SpaceComponent.Position.Y *= bounds.Y - float32(cm.MapScene.levelData.TileHeight) - diameter // Make sure we can't intersect with the bottom or right walls
+	// Make creature size based on amount of stored food
+	creature.SpaceComponent = common.SpaceComponent{
+		Position: engo.Point{X: center.X - diameter/2, Y: center.Y - diameter/2},
+		Width:    diameter,
+		Height:   diameter,
 	}
 
-	// Creatures should look like red circles
+	// Creatures should look like circles coloured by their traits (SpeciationSystem recolours them if colorBy is "species")
 	creature.RenderComponent = common.RenderComponent{
 		Drawable: common.Circle{},
 		Scale:    engo.Point{X: 1, Y: 1},
-		Color:    color.RGBA{255, 0, 0, 200},
+		Color:    creature.TraitComponent.color(),
 	}
 
 	// Setup physics
 	shape := chipmunk.NewCircle(vect.Vector_Zero, diameter/2)
-	shape.SetElasticity(0)
+	shape.SetElasticity(creature.Elasticity)
 
 	mass := calculateMass(diameter)
 	body := chipmunk.NewBody(mass, shape.Moment(float32(mass)))
-	body.SetPosition(util.PntToVect(creature.Position))
-	body.SetAngle(vect.Float(0))
+	body.SetAngle(vect.Float(0)) // The PhysicsSystem moves the body to match the SpaceComponent when we add it
 	body.AddShape(shape)
 
-	creature.PhysicsComponent = chipecs.PhysicsComponent{Shape: body.Shapes[0]}
+	creature.PhysicsComponent = chipecs.PhysicsComponent{
+		Shape:           body.Shapes[0],
+		CollisionFilter: chipecs.CollisionFilter{Category: chipecs.CategoryCreature, Mask: chipecs.CategoryAll},
+		Render:          &creature.renderSpace,
+	}
+	creature.renderSpace = creature.SpaceComponent
 
-	creature.SetZIndex(2) // Z-Index 2 is reserved for creatures
+	creature.SetZIndex(2)                         // Z-Index 2 is reserved for creatures
+	creature.Hidden = cm.MapScene.culling.culls() // The CullingSystem shows us once we're in view
 
 	// Append the creature to the Creatures slice so the System tracks it
 	cm.Creatures[creature.ID()] = creature
@@ -297,13 +581,92 @@ func (cm *CreatureManagerSystem) spawnCreature() {
 	for _, system := range cm.World.Systems() {
 		switch sys := system.(type) {
 		case *common.RenderSystem:
-			sys.Add(&creature.BasicEntity, &creature.RenderComponent, &creature.SpaceComponent)
+			sys.Add(&creature.BasicEntity, &creature.RenderComponent, &creature.renderSpace)
 		case *chipecs.PhysicsSystem:
 			sys.Add(&creature.BasicEntity, &creature.PhysicsComponent, &creature.SpaceComponent)
 		}
 	}
+
+	if cm.hash != nil {
+		cm.hash.insert(creature) // So that creatures spawned later this tick don't overlap with us
+	}
+
+	cm.Lineage.add(creature)
+	engo.Mailbox.Dispatch(CreatureBirthMessage{Creature: creature})
+	return creature
+}
+
+// mateCompatibilityChance is the multiplier on the chance that a and b successfully mate,
+// which goes down as their genomes get further apart according to mateCompatibility
+func mateCompatibilityChance(a, b *Creature) float64 {
+	d := float64(genomeDistance(a.genome(), b.genome()))
+	switch mateCompatibility {
+	case "linear":
+		return math.Max(0, 1-d/mateCompatibilityScale)
+	case "exponential":
+		return math.Exp(-d / mateCompatibilityScale)
+	}
+	return 1
+}
+
+// inherit replaces the weights in b with weights picked at random from the brains of parents using r, and then mutates them
+func (b *BrainComponent) inherit(r *rand.Rand, parents []*Creature) {
+	mutate := func(w float32) float32 {
+		if r.Float32() < mutationRate {
+			w += float32(r.NormFloat64() * mutationStrength)
+		}
+		return w
+	}
+
+	for k := range b.Output {
+		p := parents[r.Intn(len(parents))]
+		if k < len(p.Output) {
+			b.Output[k].Weight = p.Output[k].Weight
+		}
+		b.Output[k].Weight = mutate(b.Output[k].Weight)
+	}
+	for i := range b.HiddenLayer {
+		p := parents[r.Intn(len(parents))]
+		if i < len(p.HiddenLayer) {
+			b.HiddenLayer[i].Weight = p.HiddenLayer[i].Weight
+		}
+		b.HiddenLayer[i].Weight = mutate(b.HiddenLayer[i].Weight)
+	}
 }
 
 func calculateMass(diameter float32) vect.Float {
 	return vect.Float(diameter * massMultiplier)
 }
+
+// validateMatingFlags checks the sexual reproduction tunables
+func validateMatingFlags() error {
+	if mateChance < 0 || mateChance > 1 {
+		return fmt.Errorf("-mate-chance must be between 0 and 1, got %v", mateChance)
+	}
+	if mateCompatibilityScale <= 0 {
+		return fmt.Errorf("-mate-compatibility-scale must be positive, got %v", mateCompatibilityScale)
+	}
+	return checkChoice("mate-compatibility", mateCompatibility, "none", "linear", "exponential")
+}
+
+// validateAgeFlags checks the ageing tunables
+func validateAgeFlags() error {
+	if senescenceFoodCost < 0 {
+		return fmt.Errorf("-senescence-cost must not be negative, got %v", senescenceFoodCost)
+	}
+	if senescenceAge <= 0 {
+		return fmt.Errorf("-senescence-age must be positive, got %v", senescenceAge)
+	}
+	if maxLifespan < 0 {
+		return fmt.Errorf("-lifespan must not be negative, got %v", maxLifespan)
+	}
+	return nil
+}
+
+// validateBrainFlags checks the brain evaluation tunables
+func validateBrainFlags() error {
+	if brainWorkers < 0 {
+		return fmt.Errorf("-brain-workers must not be negative, got %v", brainWorkers)
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"engo.io/ecs"
+	"engo.io/engo"
+)
+
+// Big enough that the worker pool has many batches to share out, run the tests with -race to check it for data races
+const (
+	largeWorldSize  = 256
+	largePopulation = 3000
+)
+
+// newTestScene sets up a headless synthetic world that's size by size tiles and keeps population creatures in it,
+// with both the map and the creatures generated from seed
+// The scene gets its own engo.Mailbox, and the old one is put back once the test is done
+func newTestScene(tb testing.TB, size, population int, seed int64) (*ecs.World, *MapScene) {
+	tb.Helper()
+	mailbox, oldSeed := engo.Mailbox, randomSeed
+	engo.Mailbox, randomSeed = &engo.MessageManager{}, seed
+	tb.Cleanup(func() { engo.Mailbox, randomSeed = mailbox, oldSeed })
+
+	world := &ecs.World{}
+	ms := &MapScene{}
+	ms.setupSynthetic(world, size, size, population, seed)
+	return world, ms
+}
+
+// withBrainWorkers runs the rest of the test with the worker pool set to workers goroutines taking batchSize creatures at a time
+func withBrainWorkers(tb testing.TB, workers, batchSize int) {
+	oldWorkers, oldBatchSize := brainWorkers, brainBatchSize
+	brainWorkers, brainBatchSize = workers, batchSize
+	tb.Cleanup(func() { brainWorkers, brainBatchSize = oldWorkers, oldBatchSize })
+}
+
+func TestSpawnCreatureTopology(t *testing.T) {
+	_, ms := newTestScene(t, 32, 0, 1)
+	cm := ms.creatureManager
+	want := len(networkInputs) + len(networkOutputs) + 1 // Plus the const neuron
+
+	var parents []*Creature
+	for i := 0; i < 20; i++ {
+		if c := cm.spawnCreature(newbornFood); c != nil {
+			parents = append(parents, c)
+		}
+	}
+	if len(parents) < 2 {
+		t.Fatalf("only spawned %d creatures", len(parents))
+	}
+	children := []*Creature{
+		cm.spawnCreature(newbornFood, parents[0]),
+		cm.spawnCreature(newbornFood, parents[0], parents[1]),
+	}
+	for _, c := range append(parents, children...) {
+		if c == nil {
+			continue
+		}
+		if len(c.HiddenLayer) != want {
+			t.Errorf("creature %d has %d hidden neurons, want %d", c.ID(), len(c.HiddenLayer), want)
+		}
+	}
+}
+
+// senseCreatures spawns n creatures in a headless world that's size by size tiles, and has them sense it so that they're ready to think
+// They're spawned before the first tick, so they're allowed to overlap each other
+func senseCreatures(tb testing.TB, size, n int) []*Creature {
+	tb.Helper()
+	_, ms := newTestScene(tb, size, 0, 1)
+	cm := ms.creatureManager
+	for i := 0; i < n; i++ {
+		if cm.spawnCreature(newbornFood) == nil {
+			tb.Fatalf("only had room for %d creatures", i)
+		}
+	}
+	cm.hash = newCreatureHash(ms.bounds(), creatureHashCellSize)
+	creatures := cm.sortedCreatures()
+	for _, c := range creatures {
+		cm.hash.insert(c)
+	}
+	for _, c := range creatures {
+		c.sense(cm)
+	}
+	return creatures
+}
+
+func TestThinkAllMatchesThink(t *testing.T) {
+	withBrainWorkers(t, 8, 16)
+	creatures := senseCreatures(t, largeWorldSize, largePopulation)
+
+	thinkAll(creatures)
+	parallel := make([][]Axon, len(creatures))
+	for i, c := range creatures {
+		parallel[i] = append([]Axon(nil), c.Output...)
+	}
+	for i, c := range creatures {
+		c.think()
+		if !reflect.DeepEqual(c.Output, parallel[i]) {
+			t.Fatalf("creature %d thought %v in parallel, but %v on its own", c.ID(), parallel[i], c.Output)
+		}
+	}
+}
+
+func TestUpdateLargePopulation(t *testing.T) {
+	for _, batched := range []bool{false, true} {
+		name := "think"
+		if batched {
+			name = "batched"
+		}
+		t.Run(name, func(t *testing.T) {
+			withBrainWorkers(t, 8, 16)
+			old := batchedBrains
+			batchedBrains = batched
+			defer func() { batchedBrains = old }()
+
+			// Spawning stops once there isn't room for creatures without overlapping, so this is the most that a single tick can have
+			world, ms := newTestScene(t, largeWorldSize, largePopulation, 1)
+			world.Update(1.0 / 60)
+			if n, want := len(ms.creatureManager.Creatures), 8*16*2; n < want {
+				t.Fatalf("population is %d, want at least %d so that every worker gets a few batches", n, want)
+			}
+			for i := 0; i < 5; i++ {
+				world.Update(1.0 / 60)
+			}
+		})
+	}
+}
+
+func TestNearbyInput(t *testing.T) {
+	_, ms := newTestScene(t, 32, 0, 1)
+	cm := ms.creatureManager
+	var creatures []*Creature
+	for i := 0; i < 4; i++ {
+		c := cm.spawnCreature(newbornFood)
+		if c == nil {
+			t.Fatal("no room for creatures")
+		}
+		creatures = append(creatures, c)
+	}
+	// Three creatures in a row close together, and one far away from them
+	for i, p := range []engo.Point{{X: 200, Y: 200}, {X: 200 + nearbyRange/2, Y: 200}, {X: 200 + nearbyRange, Y: 200}, {X: 800, Y: 800}} {
+		c := creatures[i]
+		c.Position = engo.Point{X: p.X - c.Width/2, Y: p.Y - c.Height/2}
+	}
+	cm.rebuildHash()
+
+	for i, want := range []float32{2, 2, 2, 0} {
+		creatures[i].sense(cm)
+		if got := creatures[i].input("nearby").Value; got != want {
+			t.Errorf("creature %d senses %v nearby, want %v", i, got, want)
+		}
+	}
+}
+
+func TestHashFollowsCreatures(t *testing.T) {
+	world, ms := newTestScene(t, 64, 200, 1)
+	cm := ms.creatureManager
+	for i := 0; i < 30; i++ {
+		world.Update(1.0 / 60)
+
+		// Every living creature should be in the cell it's in now that physics has moved it, and nothing else should be in the hash
+		var hashed int
+		for _, cell := range cm.hash.cells {
+			for _, c := range cell {
+				if _, alive := cm.Creatures[c.ID()]; !alive {
+					t.Fatalf("tick %d: dead creature %d is still in the hash", cm.Tick, c.ID())
+				}
+				hashed++
+			}
+		}
+		if hashed != len(cm.Creatures) {
+			t.Fatalf("tick %d: %d creatures are in the hash, want %d", cm.Tick, hashed, len(cm.Creatures))
+		}
+		for _, c := range cm.Creatures {
+			// Update resizes creatures without moving their SpaceComponent until physics syncs, so we use where the body is
+			p := c.Shape.Body.Position()
+			x, y := cm.hash.cell(engo.Point{X: float32(p.X), Y: float32(p.Y)})
+			found := false
+			for _, other := range cm.hash.cells[y*cm.hash.cols+x] {
+				found = found || other == c
+			}
+			if !found {
+				t.Fatalf("tick %d: creature %d isn't in the cell it's in", cm.Tick, c.ID())
+			}
+		}
+	}
+}
+
+func TestSurvivingAnAttackForgetsIt(t *testing.T) {
+	_, ms := newTestScene(t, 32, 0, 1)
+	cm := ms.creatureManager
+	c := cm.spawnCreature(newbornFood)
+	if c == nil {
+		t.Fatal("no room for a creature")
+	}
+	c.killedBy = causePredation // As if an attack had left us starving before we ate our way back out of it
+
+	cm.Update(1.0 / 60)
+	if _, alive := cm.Creatures[c.ID()]; !alive {
+		t.Fatal("creature with plenty of food died")
+	}
+	if c.killedBy != "" {
+		t.Errorf("killedBy = %q after surviving, want it cleared so a later death isn't blamed on the attack", c.killedBy)
+	}
+}
+
+func TestDivideOnlyPaysForClonesThatSpawn(t *testing.T) {
+	old := asexualReproduction
+	asexualReproduction = true
+	defer func() { asexualReproduction = old }()
+
+	for _, room := range []bool{true, false} {
+		_, ms := newTestScene(t, 32, 0, 1)
+		cm := ms.creatureManager
+		parent := cm.spawnCreature(2 * divideMinFood)
+		if parent == nil {
+			t.Fatal("no room for a creature")
+		}
+		// Divide ends up far above its threshold, but eating and attacking would cost more food than the parent has, so they're left off
+		for i := range parent.HiddenLayer {
+			parent.HiddenLayer[i].Weight = 1
+		}
+		for i := range parent.Output {
+			parent.Output[i].Weight = 1
+		}
+		parent.output("eat").Weight = 0
+		parent.output("attack").Weight = 0
+		attempts := spawnAttempts
+		if !room {
+			spawnAttempts = 0 // So that there's never anywhere to put the clone
+		}
+		cm.Update(1.0 / 60)
+		spawnAttempts = attempts
+
+		paid := parent.Lifetime.Expenditure[energyDivision]
+		if room && (len(cm.Creatures) != 2 || paid == 0) {
+			t.Errorf("with room: %d creatures and paid %v for dividing, want a clone that was paid for", len(cm.Creatures), paid)
+		}
+		if !room && (len(cm.Creatures) != 1 || paid != 0) {
+			t.Errorf("without room: %d creatures and paid %v for dividing, want no clone and nothing paid", len(cm.Creatures), paid)
+		}
+	}
+}
+
+func TestSeededSpawnsRepeat(t *testing.T) {
+	spawn := func() []*Creature {
+		_, ms := newTestScene(t, 32, 0, 7)
+		var creatures []*Creature
+		for i := 0; i < 10; i++ {
+			if c := ms.creatureManager.spawnCreature(newbornFood); c != nil {
+				creatures = append(creatures, c)
+			}
+		}
+		return creatures
+	}
+	first, second := spawn(), spawn()
+	if len(first) == 0 || len(first) != len(second) {
+		t.Fatalf("spawned %d and then %d creatures from the same seed", len(first), len(second))
+	}
+	for i := range first {
+		a, b := first[i], second[i]
+		if a.Position != b.Position || a.TraitComponent != b.TraitComponent ||
+			!reflect.DeepEqual(a.HiddenLayer, b.HiddenLayer) || !reflect.DeepEqual(a.Output, b.Output) {
+			t.Errorf("creature %d differs between two runs with the same seed", i)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"log"
+
+	"engo.io/ecs"
+	"engo.io/engo"
+	"engo.io/engo/common"
+)
+
+var (
+	cullRendering         = true // Whether to hide creatures and tiles outside of the camera's view so that they don't get drawn
+	cullMargin    float32 = 64   // Extra space around the camera's view that is still drawn, in pixels
+)
+
+// CullingSystem hides everything that the camera can't see, using the tile grid and the creature spatial hash
+// so that it only has to look at things near the view
+// This type implements the engo.System interface
+type CullingSystem struct {
+	// MapScene holds the tiles and creatures that we cull
+	MapScene *MapScene
+
+	camera           *common.CameraSystem
+	hidTiles         bool // Whether every tile has been hidden yet, which has to wait until they've all been made
+	visibleTiles     []*tileEntity
+	visibleCreatures []*Creature
+}
+
+// New is called when the CullingSystem is added to the scene
+func (cs *CullingSystem) New(world *ecs.World) {
+	for _, system := range world.Systems() {
+		if camera, ok := system.(*common.CameraSystem); ok {
+			cs.camera = camera
+		}
+	}
+	if cs.camera == nil {
+		log.Println("CullingSystem couldn't find a CameraSystem, so nothing will be culled.")
+	}
+	log.Println("CullingSystem was added to the scene.")
+}
+
+// culls tells us if cs is actually hiding what the camera can't see, which it can't do without a camera
+func (cs *CullingSystem) culls() bool {
+	return cs != nil && cs.camera != nil
+}
+
+// Remove is called when an entity is removed, we look entities up every frame so we do nothing
+func (cs *CullingSystem) Remove(ecs.BasicEntity) {}
+
+// Update is called every frame
+func (cs *CullingSystem) Update(dt float32) {
+	ms := cs.MapScene
+	if cs.camera == nil || ms.creatureManager == nil || ms.creatureManager.hash == nil {
+		return
+	}
+	if !cs.hidTiles {
+		ms.tiles.each(func(t *tileEntity) { t.Hidden = true })
+		cs.hidTiles = true
+	}
+
+	// The camera is centred on X, Y and Z zooms it out
+	halfWidth := engo.GameWidth()*cs.camera.Z()/2 + cullMargin
+	halfHeight := engo.GameHeight()*cs.camera.Z()/2 + cullMargin
+	min := engo.Point{X: cs.camera.X() - halfWidth, Y: cs.camera.Y() - halfHeight}
+	max := engo.Point{X: cs.camera.X() + halfWidth, Y: cs.camera.Y() + halfHeight}
+
+	// Hide whatever we showed last frame, then show whatever is in view now
+	for _, t := range cs.visibleTiles {
+		t.Hidden = true
+	}
+	cs.visibleTiles = cs.visibleTiles[:0]
+	// Clamp to the grid so that zooming out a long way doesn't have us looking through cells that don't exist
+	minX, minY := ms.cell(min)
+	maxX, maxY := ms.cell(max)
+	if minX < 0 {
+		minX = 0
+	}
+	if minY < 0 {
+		minY = 0
+	}
+	if maxX >= ms.width {
+		maxX = ms.width - 1
+	}
+	if maxY >= ms.height {
+		maxY = ms.height - 1
+	}
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			if t, exists := ms.tiles.at(x, y); exists {
+				t.Hidden = false
+				cs.visibleTiles = append(cs.visibleTiles, t)
+			}
+		}
+	}
+
+	for _, c := range cs.visibleCreatures {
+		c.Hidden = true
+	}
+	cs.visibleCreatures = cs.visibleCreatures[:0]
+	ms.creatureManager.hash.query(min, max, func(c *Creature) {
+		c.Hidden = false
+		cs.visibleCreatures = append(cs.visibleCreatures, c)
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import "fmt"
+
+var starvationFood float32 = 0.3 // Creatures with less StoredFood than this die
+
+// energyCategory is something that a creature can gain food from or spend food on
+type energyCategory int
+
+// Every energyCategory, income categories come first
+const (
+	energyPlants     energyCategory = iota // Eating the plants on a tile
+	energyCarcasses                        // Eating the carcasses left on a tile
+	energyPredation                        // Taking food from another creature by attacking it
+	energyBase                             // Staying alive
+	energySenescence                       // Getting old
+	energyTraits                           // Having the traits we have
+	energyTurning                          // Turning
+	energyMovement                         // Accelerating
+	energyEating                           // Trying to eat
+	energyAttacking                        // Trying to attack
+	energyDeadlyTile                       // Being on a deadly tile
+	energyPredated                         // Being attacked by another creature
+	energyDivision                         // Giving half our food to a clone when we divide
+	energyCategoryCount
+)
+
+var energyCategoryNames = [energyCategoryCount]string{
+	"plants", "carcasses", "predation", "base", "senescence", "traits", "turning",
+	"movement", "eating", "attacking", "deadlytile", "predated", "division",
+}
+
+func (c energyCategory) String() string {
+	return energyCategoryNames[c]
+}
+
+// energyBudget holds the food gained and spent in each category over some period
+type energyBudget struct {
+	Income      [energyCategoryCount]float32
+	Expenditure [energyCategoryCount]float32
+}
+
+// net is the total food gained minus the total food spent
+func (b *energyBudget) net() float32 {
+	var net float32
+	for c := energyCategory(0); c < energyCategoryCount; c++ {
+		net += b.Income[c] - b.Expenditure[c]
+	}
+	return net
+}
+
+// EnergyComponent holds the food a creature has stored, and accounts for where it came from and where it went
+// StoredFood should only be changed through gain and spend once the creature has been spawned
+type EnergyComponent struct {
+	// StoredFood is the food the creature currently has, it dies if this gets too low
+	StoredFood float32
+	// LastTick is the budget over the last complete tick
+	LastTick energyBudget
+	// Lifetime is the budget over the creature's whole life
+	Lifetime energyBudget
+
+	current energyBudget // The budget for the tick that's in progress
+}
+
+// gain adds amount food from category c
+// amount must not be negative, costs should be accounted for with spend
+func (e *EnergyComponent) gain(c energyCategory, amount float32) {
+	if amount < 0 {
+		panic(fmt.Sprintf("negative energy gain of %v from %v", amount, c))
+	}
+	e.StoredFood += amount
+	e.current.Income[c] += amount
+	e.Lifetime.Income[c] += amount
+}
+
+// spend uses up amount food on category c
+// amount must not be negative, a cost should never be a way to gain food
+func (e *EnergyComponent) spend(c energyCategory, amount float32) {
+	if amount < 0 {
+		panic(fmt.Sprintf("negative energy cost of %v for %v", amount, c))
+	}
+	e.StoredFood -= amount
+	e.current.Expenditure[c] += amount
+	e.Lifetime.Expenditure[c] += amount
+}
+
+// endTick makes the tick that's in progress the LastTick, and starts a new one
+func (e *EnergyComponent) endTick() {
+	e.LastTick = e.current
+	e.current = energyBudget{}
+}
+
+// starving tells us if we have so little food left that we should die
+func (e *EnergyComponent) starving() bool {
+	return e.StoredFood < starvationFood
+}
+
+// foodEaten is the total food the creature has ever gotten from eating, including from attacking other creatures
+func (e *EnergyComponent) foodEaten() float32 {
+	return e.Lifetime.Income[energyPlants] + e.Lifetime.Income[energyCarcasses] + e.Lifetime.Income[energyPredation]
+}
+
+// positive returns v if it's greater than 0, and 0 otherwise
+// Costs that are proportional to a network output go through this so that negative outputs aren't rewarded
+func positive(v float32) float32 {
+	if v > 0 {
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,114 @@
+package main
+
+import "testing"
+
+func TestEnergyGainSpend(t *testing.T) {
+	tests := []struct {
+		name        string
+		start       float32
+		gains       map[energyCategory]float32
+		spends      map[energyCategory]float32
+		wantFood    float32
+		wantNet     float32
+		wantStarved bool
+	}{
+		{name: "nothing", start: 8, wantFood: 8},
+		{name: "gain", start: 8, gains: map[energyCategory]float32{energyPlants: 2, energyCarcasses: 1}, wantFood: 11, wantNet: 3},
+		{name: "spend", start: 8, spends: map[energyCategory]float32{energyBase: 0.5, energyMovement: 1.5}, wantFood: 6, wantNet: -2},
+		{name: "both", start: 8, gains: map[energyCategory]float32{energyPredation: 1}, spends: map[energyCategory]float32{energyAttacking: 3}, wantFood: 6, wantNet: -2},
+		{name: "zero amounts", start: 8, gains: map[energyCategory]float32{energyPlants: 0}, spends: map[energyCategory]float32{energyBase: 0}, wantFood: 8},
+		{name: "starve", start: 1, spends: map[energyCategory]float32{energyBase: 0.8}, wantFood: 0.2, wantNet: -0.8, wantStarved: true},
+		{name: "just above starving", start: 1, spends: map[energyCategory]float32{energyBase: 0.5}, wantFood: 0.5, wantNet: -0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := EnergyComponent{StoredFood: tt.start}
+			for c, amount := range tt.gains {
+				e.gain(c, amount)
+			}
+			for c, amount := range tt.spends {
+				e.spend(c, amount)
+			}
+			if !closeTo(e.StoredFood, tt.wantFood) {
+				t.Errorf("StoredFood = %v, want %v", e.StoredFood, tt.wantFood)
+			}
+			if e.starving() != tt.wantStarved {
+				t.Errorf("starving() = %v, want %v", e.starving(), tt.wantStarved)
+			}
+
+			// Nothing shows up in LastTick until the tick is over
+			if net := e.LastTick.net(); net != 0 {
+				t.Errorf("LastTick.net() before endTick = %v, want 0", net)
+			}
+			e.endTick()
+			if net := e.LastTick.net(); !closeTo(net, tt.wantNet) {
+				t.Errorf("LastTick.net() = %v, want %v", net, tt.wantNet)
+			}
+			for c, amount := range tt.gains {
+				if e.LastTick.Income[c] != amount || e.Lifetime.Income[c] != amount {
+					t.Errorf("income from %v = %v (lifetime %v), want %v", c, e.LastTick.Income[c], e.Lifetime.Income[c], amount)
+				}
+			}
+			for c, amount := range tt.spends {
+				if e.LastTick.Expenditure[c] != amount || e.Lifetime.Expenditure[c] != amount {
+					t.Errorf("expenditure on %v = %v (lifetime %v), want %v", c, e.LastTick.Expenditure[c], e.Lifetime.Expenditure[c], amount)
+				}
+			}
+		})
+	}
+}
+
+func TestEnergyEndTick(t *testing.T) {
+	var e EnergyComponent
+	e.gain(energyPlants, 2)
+	e.endTick()
+	e.spend(energyBase, 1)
+	e.endTick()
+
+	if e.LastTick.Income[energyPlants] != 0 || e.LastTick.Expenditure[energyBase] != 1 {
+		t.Errorf("LastTick = %+v, want only the second tick's spending", e.LastTick)
+	}
+	if e.Lifetime.Income[energyPlants] != 2 || e.Lifetime.Expenditure[energyBase] != 1 {
+		t.Errorf("Lifetime = %+v, want both ticks", e.Lifetime)
+	}
+	if e.current != (energyBudget{}) {
+		t.Errorf("current = %+v, want an empty budget after endTick", e.current)
+	}
+}
+
+func TestEnergyFoodEaten(t *testing.T) {
+	var e EnergyComponent
+	e.gain(energyPlants, 1)
+	e.gain(energyCarcasses, 2)
+	e.gain(energyPredation, 3)
+	e.spend(energyEating, 4)
+	if got := e.foodEaten(); got != 6 {
+		t.Errorf("foodEaten() = %v, want 6", got)
+	}
+}
+
+func TestEnergyNegativePanics(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(e *EnergyComponent)
+	}{
+		{"gain", func(e *EnergyComponent) { e.gain(energyPlants, -1) }},
+		{"spend", func(e *EnergyComponent) { e.spend(energyBase, -1) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("want a panic for a negative amount")
+				}
+			}()
+			tt.fn(&EnergyComponent{StoredFood: 8})
+		})
+	}
+}
+
+// closeTo tells us if a and b are equal apart from float32 rounding
+func closeTo(a, b float32) bool {
+	d := a - b
+	return d < 1e-5 && d > -1e-5
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+
+	"engo.io/ecs"
+	"engo.io/engo"
+)
+
+var (
+	goldenSize             = 32                                       // Width and height of the synthetic world golden runs use, in tiles
+	goldenPopulation       = 50                                       // MinCreatures for golden runs
+	goldenTicks            = 600                                      // Number of ticks each golden run lasts
+	goldenInterval         = 100                                      // Number of ticks between each snapshot in a golden run
+	goldenSeed       int64 = 1                                        // Seed for both the synthetic world and the random number generator in golden runs
+	goldenTolerance        = 1e-3                                     // Largest difference between two floats that still counts as a match, relative to the larger of them once it's over 1
+	goldenPath             = filepath.Join("testdata", "golden.json") // Golden file that TestGoldenRun compares against
+)
+
+// goldenRun is everything we record about a golden run, and what gets saved to golden files
+type goldenRun struct {
+	Size       int              `json:"size"`
+	Population int              `json:"population"`
+	Seed       int64            `json:"seed"`
+	Snapshots  []goldenSnapshot `json:"snapshots"`
+}
+
+// goldenSnapshot is the state of a golden run at a single tick
+type goldenSnapshot struct {
+	Tick       int              `json:"tick"`
+	Population int              `json:"population"`
+	StoredFood float32          `json:"stored_food"` // StoredFood summed over the population
+	TileFood   float32          `json:"tile_food"`   // foodStored and carcassFood summed over every tile
+	Creatures  []goldenCreature `json:"creatures"`   // In ascending order of ID
+}
+
+// goldenCreature is the state of a single creature in a goldenSnapshot
+type goldenCreature struct {
+	X          float32 `json:"x"`
+	Y          float32 `json:"y"`
+	StoredFood float32 `json:"stored_food"`
+	Age        int     `json:"age"`
+	Generation int     `json:"generation"`
+}
+
+// recordGoldenRun runs world, which has to have been set up with setupSynthetic using the golden size, population and seed, and records it
+func recordGoldenRun(world *ecs.World, ms *MapScene) goldenRun {
+	run := goldenRun{Size: goldenSize, Population: goldenPopulation, Seed: goldenSeed}
+	for tick := 1; tick <= goldenTicks; tick++ {
+		world.Update(1.0 / 60)
+		if tick%goldenInterval == 0 {
+			run.Snapshots = append(run.Snapshots, ms.goldenSnapshot())
+		}
+	}
+	return run
+}
+
+// goldenSnapshot records the current state of the simulation
+func (ms *MapScene) goldenSnapshot() goldenSnapshot {
+	snap := goldenSnapshot{Tick: ms.creatureManager.Tick}
+	for _, c := range ms.creatureManager.sortedCreatures() {
+		snap.Population++
+		snap.StoredFood += c.StoredFood
+		snap.Creatures = append(snap.Creatures, goldenCreature{
+			X:          c.Position.X,
+			Y:          c.Position.Y,
+			StoredFood: c.StoredFood,
+			Age:        c.Age,
+			Generation: c.Generation,
+		})
+	}
+	for _, t := range ms.habitableTiles {
+		snap.TileFood += t.foodStored + t.carcassFood
+	}
+	return snap
+}
+
+// updateGolden records a golden run and writes it to path, so that TestGoldenRun compares against it from then on
+// It changes randomSeed and engo.Mailbox, so it has to be the only simulation in the process
+func updateGolden(path string) error {
+	randomSeed = goldenSeed
+	engo.Mailbox = &engo.MessageManager{}
+	world := &ecs.World{}
+	ms := &MapScene{}
+	ms.setupSynthetic(world, goldenSize, goldenSize, goldenPopulation, goldenSeed)
+
+	data, err := json.MarshalIndent(recordGoldenRun(world, ms), "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// readGolden reads the golden run saved at path
+func readGolden(path string) (goldenRun, error) {
+	var run goldenRun
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return run, err
+	}
+	err = json.Unmarshal(data, &run)
+	return run, err
+}
+
+// compareGoldenRuns returns an error describing the first place got differs from want
+func compareGoldenRuns(want, got goldenRun) error {
+	if want.Size != got.Size || want.Population != got.Population || want.Seed != got.Seed {
+		return fmt.Errorf("golden file was recorded with size %d, population %d and seed %d, but this run used %d, %d and %d",
+			want.Size, want.Population, want.Seed, got.Size, got.Population, got.Seed)
+	}
+	if len(want.Snapshots) != len(got.Snapshots) {
+		return fmt.Errorf("want %d snapshots, got %d", len(want.Snapshots), len(got.Snapshots))
+	}
+	for i, w := range want.Snapshots {
+		g := got.Snapshots[i]
+		switch {
+		case w.Tick != g.Tick:
+			return fmt.Errorf("snapshot %d: want tick %d, got %d", i, w.Tick, g.Tick)
+		case w.Population != g.Population || len(w.Creatures) != len(g.Creatures):
+			return fmt.Errorf("tick %d: want population %d, got %d", w.Tick, w.Population, g.Population)
+		case !goldenClose(w.StoredFood, g.StoredFood):
+			return fmt.Errorf("tick %d: want total stored food %g, got %g", w.Tick, w.StoredFood, g.StoredFood)
+		case !goldenClose(w.TileFood, g.TileFood):
+			return fmt.Errorf("tick %d: want total tile food %g, got %g", w.Tick, w.TileFood, g.TileFood)
+		}
+		for j, wc := range w.Creatures {
+			gc := g.Creatures[j]
+			if !goldenClose(wc.X, gc.X) || !goldenClose(wc.Y, gc.Y) || !goldenClose(wc.StoredFood, gc.StoredFood) ||
+				wc.Age != gc.Age || wc.Generation != gc.Generation {
+				return fmt.Errorf("tick %d: creature %d: want %+v, got %+v", w.Tick, j, wc, gc)
+			}
+		}
+	}
+	return nil
+}
+
+// goldenClose tells us if a and b are within goldenTolerance of each other
+func goldenClose(a, b float32) bool {
+	scale := math.Max(1, math.Max(math.Abs(float64(a)), math.Abs(float64(b))))
+	return math.Abs(float64(a-b)) <= goldenTolerance*scale
+}
@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+// TestGoldenRun replays the seeded synthetic world and checks that it still does exactly what it did when goldenPath was recorded
+// Changes that are meant to alter the simulation should regenerate the file with go run . -golden-update testdata/golden.json
+func TestGoldenRun(t *testing.T) {
+	want, err := readGolden(goldenPath)
+	if err != nil {
+		t.Fatalf("couldn't read golden file, record it with go run . -golden-update %s: %v", goldenPath, err)
+	}
+	world, ms := newTestScene(t, goldenSize, goldenPopulation, goldenSeed)
+	if err := compareGoldenRuns(want, recordGoldenRun(world, ms)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCompareGoldenRuns(t *testing.T) {
+	base := func() goldenRun {
+		return goldenRun{Size: 32, Population: 2, Seed: 1, Snapshots: []goldenSnapshot{{
+			Tick: 100, Population: 2, StoredFood: 16, TileFood: 500,
+			Creatures: []goldenCreature{{X: 10, Y: 20, StoredFood: 8, Age: 100}, {X: 300, Y: 40, StoredFood: 8, Age: 50, Generation: 1}},
+		}}}
+	}
+	tests := []struct {
+		name    string
+		change  func(r *goldenRun)
+		wantErr bool
+	}{
+		{"same", func(r *goldenRun) {}, false},
+		{"within tolerance", func(r *goldenRun) { r.Snapshots[0].TileFood += 0.1 }, false},
+		{"different seed", func(r *goldenRun) { r.Seed = 2 }, true},
+		{"missing snapshot", func(r *goldenRun) { r.Snapshots = nil }, true},
+		{"different population", func(r *goldenRun) { r.Snapshots[0].Population = 3 }, true},
+		{"moved creature", func(r *goldenRun) { r.Snapshots[0].Creatures[1].X += 1 }, true},
+		{"older creature", func(r *goldenRun) { r.Snapshots[0].Creatures[0].Age++ }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := base()
+			tt.change(&got)
+			if err := compareGoldenRuns(base(), got); (err != nil) != tt.wantErr {
+				t.Errorf("compareGoldenRuns() = %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
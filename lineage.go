@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+var (
+	lineagePath   string     // Where to export the lineage to when the game closes, nothing gets exported if this is empty
+	lineageFormat = "newick" // Either "newick" or "graphml"
+)
+
+// lineageRecord holds everything we know about the ancestry of a single creature
+type lineageRecord struct {
+	ID         uint64
+	Parents    []uint64 // Empty for creatures that were spawned in rather than born
+	Generation int
+	BirthTick  int
+	DeathTick  int // Only meaningful if Alive is false
+	Alive      bool
+
+	children []uint64 // Creatures whose first parent is this creature
+}
+
+// lineageStore keeps a lineageRecord for every creature that has ever existed
+// Records are never removed, so that we can always reconstruct the full history
+type lineageStore struct {
+	records map[uint64]*lineageRecord
+	roots   []uint64 // Creatures that have no parents, in the order they were added
+}
+
+func newLineageStore() *lineageStore {
+	return &lineageStore{records: make(map[uint64]*lineageRecord)}
+}
+
+// add records the birth of c
+func (ls *lineageStore) add(c *Creature) {
+	r := &lineageRecord{
+		ID:         c.ID(),
+		Parents:    c.Parents,
+		Generation: c.Generation,
+		BirthTick:  c.BirthTick,
+		Alive:      true,
+	}
+	ls.insert(r)
+}
+
+// insert adds r to the store and to its first parent's children
+func (ls *lineageStore) insert(r *lineageRecord) {
+	ls.records[r.ID] = r
+
+	// For the purposes of building a tree we only consider the first parent
+	if len(r.Parents) == 0 {
+		ls.roots = append(ls.roots, r.ID)
+	} else if p, ok := ls.records[r.Parents[0]]; ok {
+		p.children = append(p.children, r.ID)
+	} else {
+		ls.roots = append(ls.roots, r.ID) // The parent is unknown to us, so treat this as a new tree
+	}
+}
+
+// markDead records the death of the creature with id at tick
+func (ls *lineageStore) markDead(id uint64, tick int) {
+	if r, ok := ls.records[id]; ok {
+		r.Alive = false
+		r.DeathTick = tick
+	}
+}
+
+// living returns the IDs of every creature that is still alive, in ascending order
+func (ls *lineageStore) living() []uint64 {
+	var ids []uint64
+	for id, r := range ls.records {
+		if r.Alive {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// commonAncestor finds the most recent common ancestor of every creature in ids,
+// following first parents only. ok is false if the creatures don't share an ancestor.
+func (ls *lineageStore) commonAncestor(ids []uint64) (ancestor uint64, ok bool) {
+	if len(ids) == 0 {
+		return 0, false
+	}
+
+	// Count how many of the creatures in ids have each creature as an ancestor (or are it)
+	counts := make(map[uint64]int)
+	for _, id := range ids {
+		for r, exists := ls.records[id]; exists; {
+			counts[r.ID]++
+			if len(r.Parents) == 0 {
+				break
+			}
+			r, exists = ls.records[r.Parents[0]]
+		}
+	}
+
+	// The first ancestor of any creature that everyone shares is the most recent one
+	for r, exists := ls.records[ids[0]]; exists; {
+		if counts[r.ID] == len(ids) {
+			return r.ID, true
+		}
+		if len(r.Parents) == 0 {
+			break
+		}
+		r, exists = ls.records[r.Parents[0]]
+	}
+	return 0, false
+}
+
+// writeNewick writes the lineage as a Newick tree, using only first parents so that it is a tree
+// Branch lengths are the number of ticks between a parent's birth and the child's birth
+// Multiple family trees are joined under a single unnamed root
+func (ls *lineageStore) writeNewick(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("(")
+	for i, id := range ls.roots {
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		ls.writeNewickNode(bw, id, ls.records[id].BirthTick)
+	}
+	bw.WriteString(");\n")
+	return bw.Flush()
+}
+
+func (ls *lineageStore) writeNewickNode(bw *bufio.Writer, id uint64, parentBirthTick int) {
+	r := ls.records[id]
+	if len(r.children) > 0 {
+		bw.WriteString("(")
+		for i, child := range r.children {
+			if i > 0 {
+				bw.WriteString(",")
+			}
+			ls.writeNewickNode(bw, child, r.BirthTick)
+		}
+		bw.WriteString(")")
+	}
+	fmt.Fprintf(bw, "c%d:%d", r.ID, r.BirthTick-parentBirthTick)
+}
+
+// writeGraphML writes the lineage as a GraphML directed graph, with an edge from every parent to each of its children
+func (ls *lineageStore) writeGraphML(w io.Writer) error {
+	ids := make([]uint64, 0, len(ls.records))
+	for id := range ls.records {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="generation" for="node" attr.name="generation" attr.type="int"/>
+  <key id="birth" for="node" attr.name="birth_tick" attr.type="int"/>
+  <key id="death" for="node" attr.name="death_tick" attr.type="int"/>
+  <key id="alive" for="node" attr.name="alive" attr.type="boolean"/>
+  <graph id="lineage" edgedefault="directed">
+`)
+	for _, id := range ids {
+		r := ls.records[id]
+		fmt.Fprintf(bw, "    <node id=\"c%d\">\n", r.ID)
+		fmt.Fprintf(bw, "      <data key=\"generation\">%d</data>\n", r.Generation)
+		fmt.Fprintf(bw, "      <data key=\"birth\">%d</data>\n", r.BirthTick)
+		if !r.Alive {
+			fmt.Fprintf(bw, "      <data key=\"death\">%d</data>\n", r.DeathTick)
+		}
+		fmt.Fprintf(bw, "      <data key=\"alive\">%t</data>\n", r.Alive)
+		bw.WriteString("    </node>\n")
+	}
+	for _, id := range ids {
+		for _, parent := range ls.records[id].Parents {
+			fmt.Fprintf(bw, "    <edge source=\"c%d\" target=\"c%d\"/>\n", parent, id)
+		}
+	}
+	bw.WriteString("  </graph>\n</graphml>\n")
+	return bw.Flush()
+}
+
+// export writes the lineage to the file at path in the given format
+func (ls *lineageStore) export(path, format string) error {
+	var write func(io.Writer) error
+	switch format {
+	case "newick":
+		write = ls.writeNewick
+	case "graphml":
+		write = ls.writeGraphML
+	default:
+		return fmt.Errorf("unknown lineage format %q", format)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// validateLineageFlags checks the lineage tunables
+func validateLineageFlags() error {
+	return checkChoice("lineage-format", lineageFormat, "newick", "graphml")
+}
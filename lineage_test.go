@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// testLineage builds a store with two family trees:
+// c1 (born at 0) is the first parent of c3 (10) and c5 (12), c3 is the parent of c4 (25),
+// and c2 (5) is c5's second parent and has no children of its own in the tree
+func testLineage() *lineageStore {
+	ls := newLineageStore()
+	for _, r := range []*lineageRecord{
+		{ID: 1, BirthTick: 0},
+		{ID: 2, BirthTick: 5},
+		{ID: 3, Parents: []uint64{1}, Generation: 1, BirthTick: 10},
+		{ID: 4, Parents: []uint64{3}, Generation: 2, BirthTick: 25},
+		{ID: 5, Parents: []uint64{1, 2}, Generation: 1, BirthTick: 12},
+	} {
+		r.Alive = true
+		ls.insert(r)
+	}
+	ls.markDead(3, 30)
+	return ls
+}
+
+func TestCommonAncestor(t *testing.T) {
+	ls := testLineage()
+	tests := []struct {
+		ids    []uint64
+		want   uint64
+		wantOk bool
+	}{
+		{[]uint64{4, 5}, 1, true},
+		{[]uint64{3, 4}, 3, true},
+		{[]uint64{4}, 4, true},
+		{[]uint64{4, 2}, 0, false}, // c2 is only a second parent, which commonAncestor doesn't follow
+		{nil, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ls.commonAncestor(tt.ids)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("commonAncestor(%v) = %d, %v, want %d, %v", tt.ids, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestWriteNewick(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testLineage().writeNewick(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "(((c4:15)c3:10,c5:12)c1:0,c2:0);\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeNewick() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testLineage().writeGraphML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+
+	// Every parent gets an edge, including second parents, in ascending order of child
+	var edges []string
+	for _, line := range strings.Split(got, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "<edge") {
+			edges = append(edges, line)
+		}
+	}
+	wantEdges := []string{
+		`<edge source="c1" target="c3"/>`,
+		`<edge source="c3" target="c4"/>`,
+		`<edge source="c1" target="c5"/>`,
+		`<edge source="c2" target="c5"/>`,
+	}
+	if strings.Join(edges, "\n") != strings.Join(wantEdges, "\n") {
+		t.Errorf("edges = %q, want %q", edges, wantEdges)
+	}
+
+	if strings.Count(got, "<node ") != 5 {
+		t.Errorf("want 5 nodes, got:\n%s", got)
+	}
+	if strings.Count(got, `<data key="death">`) != 1 || !strings.Contains(got, `<data key="death">30</data>`) {
+		t.Errorf("want only c3 to have a death tick of 30, got:\n%s", got)
+	}
+}
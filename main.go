@@ -1,10 +1,82 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+
 	"engo.io/engo"
 )
 
 func main() {
+	flag.StringVar(&statisticsPath, "stats", statisticsPath, "File to record population statistics to (disabled if empty)")
+	flag.StringVar(&statisticsFormat, "stats-format", statisticsFormat, "Format of the statistics file, either csv or jsonl")
+	flag.IntVar(&statisticsInterval, "stats-interval", statisticsInterval, "Number of ticks between each statistics snapshot")
+	flag.StringVar(&lineagePath, "lineage", lineagePath, "File to export the lineage of every creature to when the game closes (disabled if empty)")
+	flag.StringVar(&lineageFormat, "lineage-format", lineageFormat, "Format of the lineage file, either newick or graphml")
+	flag.Var(float32Flag{&speciesThreshold}, "species-threshold", "Maximum genome distance between members of the same species (speciation is disabled if this is 0)")
+	flag.IntVar(&speciesInterval, "species-interval", speciesInterval, "Number of ticks between each reclustering of creatures into species")
+	flag.Float64Var(&mateChance, "mate-chance", mateChance, "Probability that two genetically identical creatures mate when they collide")
+	flag.StringVar(&mateCompatibility, "mate-compatibility", mateCompatibility, "How the chance of mating falls off with genome distance, one of none, linear or exponential")
+	flag.Float64Var(&mateCompatibilityScale, "mate-compatibility-scale", mateCompatibilityScale, "Genome distance at which mating becomes impossible (linear) or 1/e as likely (exponential)")
+	flag.Float64Var(&dietTradeoff, "diet-tradeoff", dietTradeoff, "Exponent of the herbivore/carnivore trade-off curve, above 1 favours specialists and below 1 favours generalists")
+	flag.BoolVar(&asexualReproduction, "asexual", asexualReproduction, "Let creatures divide into themselves and a mutated clone using their divide output")
+	flag.IntVar(&maxLifespan, "lifespan", maxLifespan, "Number of ticks after which creatures die of old age (0 means they never do)")
+	flag.IntVar(&senescenceAge, "senescence-age", senescenceAge, "Age in ticks at which the full senescence food cost is charged")
+	flag.Var(float32Flag{&senescenceFoodCost}, "senescence-cost", "Extra food used per tick by a creature that is senescence-age ticks old")
+	flag.StringVar(&colorBy, "color-by", colorBy, "What creatures are coloured by, either species or traits")
+	flag.IntVar(&physicsSubsteps, "physics-substeps", physicsSubsteps, "Number of parts each fixed physics step is split into")
+	flag.Var(stringListFlag{&solidLayers}, "solid-layers", "Comma separated names of the tile layers creatures can't move through")
+	flag.StringVar(&spawnPlacement, "spawn", spawnPlacement, "Where spawned creatures are placed, one of uniform, parents, clustered or zones")
+	flag.StringVar(&birthPlacement, "birth-spawn", birthPlacement, "Where creatures that are born are placed, one of uniform, parents, clustered or zones")
+	flag.StringVar(&spawnZoneLayer, "spawn-layer", spawnZoneLayer, "Name of the tile layer that marks out spawn zones for the zones placement")
+	flag.IntVar(&brainWorkers, "brain-workers", brainWorkers, "Number of goroutines that evaluate creature brains in parallel (0 means one per CPU)")
+	flag.BoolVar(&batchedBrains, "batched-brains", batchedBrains, "Evaluate creature brains packed into matrices instead of one at a time")
+	flag.BoolVar(&cullRendering, "cull", cullRendering, "Only draw the creatures and tiles that the camera can see")
+	flag.Int64Var(&randomSeed, "seed", randomSeed, "Seed for the random number generator (0 picks one from the current time)")
+	goldenUpdate := flag.String("golden-update", "", "Record a seeded headless run to this golden file for TestGoldenRun (normally "+goldenPath+"), then exit (disabled if empty)")
+	cpuProfile := flag.String("cpuprofile", "", "File to write a CPU profile of the whole run to (disabled if empty)")
+	memProfile := flag.String("memprofile", "", "File to write a heap profile to at the end of the run (disabled if empty)")
+	flag.Parse()
+	if err := validateFlags(); err != nil {
+		log.Fatal("Invalid flag: ", err)
+	}
+
+	if err := run(*cpuProfile, *memProfile, *goldenUpdate); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run profiles the rest of the program, if asked to, and then either records a golden run or plays the game
+// Errors are returned rather than fatal so that the deferred profile writes always happen
+func run(cpuProfile, memProfile, goldenUpdate string) error {
+	if cpuProfile != "" {
+		f, err := os.Create(cpuProfile)
+		if err != nil {
+			return fmt.Errorf("couldn't create CPU profile: %v", err)
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return fmt.Errorf("couldn't start CPU profile: %v", err)
+		}
+		defer pprof.StopCPUProfile()
+	}
+	if memProfile != "" {
+		defer writeHeapProfile(memProfile)
+	}
+
+	if goldenUpdate != "" {
+		if err := updateGolden(goldenUpdate); err != nil {
+			return fmt.Errorf("couldn't record golden run: %v", err)
+		}
+		return nil
+	}
+
 	opts := engo.RunOptions{
 		Title:          "gevo",
 		Width:          800,
@@ -16,5 +88,98 @@ func main() {
 		ScaleOnResize:  false,
 		NotResizable:   true,
 	}
-	engo.Run(opts, &MapScene{})
+	scene := &MapScene{}
+	engo.Run(opts, scene)
+	scene.finish()
+	return nil
+}
+
+// validateFlags catches tunables that would otherwise crash or break the simulation partway through a run
+// Each feature checks its own tunables in one of flagValidators
+func validateFlags() error {
+	for _, validate := range flagValidators {
+		if err := validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flagValidators check the tunables of each feature, returning an error for the first invalid one
+var flagValidators = []func() error{
+	validateStatisticsFlags,
+	validateLineageFlags,
+	validateSpeciesFlags,
+	validateMatingFlags,
+	validateDietFlags,
+	validateAgeFlags,
+	validateColorFlags,
+	validatePhysicsFlags,
+	validateSpawnFlags,
+	validateBrainFlags,
+}
+
+// checkChoice returns an error unless value, which was given to the flag called name, is one of allowed
+func checkChoice(name, value string, allowed ...string) error {
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("-%s must be one of %s, got %q", name, strings.Join(allowed, ", "), value)
+}
+
+// writeHeapProfile writes a profile of the memory that's currently in use to path
+func writeHeapProfile(path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Println("Couldn't create heap profile:", err)
+		return
+	}
+	defer f.Close()
+	runtime.GC() // Get up to date statistics
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		log.Println("Couldn't write heap profile:", err)
+	}
+}
+
+// float32Flag lets us use the float32 tunables directly as flags
+type float32Flag struct {
+	p *float32
+}
+
+func (f float32Flag) String() string {
+	if f.p == nil {
+		return ""
+	}
+	return strconv.FormatFloat(float64(*f.p), 'g', -1, 32)
+}
+
+func (f float32Flag) Set(s string) error {
+	v, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return err
+	}
+	*f.p = float32(v)
+	return nil
+}
+
+// stringListFlag lets us use comma separated lists as flags
+type stringListFlag struct {
+	p *[]string
+}
+
+func (f stringListFlag) String() string {
+	if f.p == nil {
+		return ""
+	}
+	return strings.Join(*f.p, ",")
+}
+
+func (f stringListFlag) Set(s string) error {
+	*f.p = nil
+	if s != "" {
+		*f.p = strings.Split(s, ",")
+	}
+	return nil
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// badFlags holds a value that validateFlags should reject for each of the tunables that it checks
+var badFlags = []struct {
+	name string
+	p    interface{} // Pointer to the tunable
+	bad  interface{}
+}{
+	{"stats-format", &statisticsFormat, "xml"},
+	{"stats-interval", &statisticsInterval, 0},
+	{"lineage-format", &lineageFormat, "nexus"},
+	{"species-threshold", &speciesThreshold, float32(-1)},
+	{"species-interval", &speciesInterval, 0},
+	{"mate-chance", &mateChance, 1.5},
+	{"mate-chance", &mateChance, -0.1},
+	{"mate-compatibility", &mateCompatibility, "quadratic"},
+	{"mate-compatibility-scale", &mateCompatibilityScale, 0.0},
+	{"diet-tradeoff", &dietTradeoff, 0.0},
+	{"senescence-cost", &senescenceFoodCost, float32(-0.1)},
+	{"senescence-age", &senescenceAge, 0},
+	{"lifespan", &maxLifespan, -1},
+	{"color-by", &colorBy, "age"},
+	{"physics-substeps", &physicsSubsteps, 0},
+	{"spawn", &spawnPlacement, "everywhere"},
+	{"birth-spawn", &birthPlacement, "everywhere"},
+	{"brain-workers", &brainWorkers, -1},
+}
+
+func TestValidateFlags(t *testing.T) {
+	if err := validateFlags(); err != nil {
+		t.Fatalf("validateFlags() with the defaults = %v, want nil", err)
+	}
+	for _, tt := range badFlags {
+		t.Run(tt.name, func(t *testing.T) {
+			v := reflect.ValueOf(tt.p).Elem()
+			old := reflect.ValueOf(v.Interface())
+			v.Set(reflect.ValueOf(tt.bad))
+			defer v.Set(old)
+			if err := validateFlags(); err == nil {
+				t.Errorf("validateFlags() with -%s %v = nil, want an error", tt.name, tt.bad)
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"fmt"
+	"image"
 	"image/color"
 	"log"
 	"math"
+	"path/filepath"
 
 	"engo.io/ecs"
 	"engo.io/engo"
@@ -16,8 +19,17 @@ import (
 
 // MapScene satisfies the Scene interface
 type MapScene struct {
-	levelData    *common.Level
-	tileEntities map[engo.Point]*tileEntity
+	tileWidth       int // Width of a single tile in pixels
+	tileHeight      int // Height of a single tile in pixels
+	width           int // Width of the map in tiles
+	height          int // Height of the map in tiles
+	tiles           tileGrid
+	creatureManager *CreatureManagerSystem
+	statistics      *StatisticsSystem // nil unless statisticsPath is set
+	culling         *CullingSystem    // nil unless cullRendering is set
+	habitableTiles  []*tileEntity     // Tiles that creatures can be spawned on, they aren't solid or deadly
+	spawnZones      []*tileEntity     // Tiles from spawnZoneLayer, these aren't added to any systems
+	boundary, solid ecs.BasicEntity   // Own the static bodies of the map's edges and solid tiles, so that physics queries can report them
 }
 
 // Label entity holds labels
@@ -40,15 +52,30 @@ type tileEntity struct {
 type foodComponent struct {
 	waterDistance float32 // The distance in horizontal or vertical tiles from the current tile to a water tile (is 0 for water tiles)
 	foodStored    float32 // Maxes out at (1 / waterDistance) * worldFertility, and goes lower when creature eats this tile
+	carcassFood   float32 // Food left behind by creatures that died on this tile, which is used up when it's eaten
 	deadly        bool    // Should creatures lose food when on this tile
 }
 
+// setWaterDistance sets waterDistance and fills foodStored up to the maximum for that distance
+func (f *foodComponent) setWaterDistance(d float32) {
+	f.waterDistance = d
+	f.foodStored = (1 / d) * worldFertility
+}
+
+// color is the shade of green food tiles are drawn in, which is brighter the more food they have
+func (f *foodComponent) color() color.Color {
+	mod := uint8((f.foodStored / worldFertility) * 200)
+	return color.RGBA{0, mod, 0, 255}
+}
+
 var err error
 
 var (
-	scrollSpeed    float32 = 700.0
-	zoomSpeed      float32 = -0.1
-	worldFertility float32 = 1.5
+	scrollSpeed     float32  = 700.0
+	zoomSpeed       float32  = -0.1
+	worldFertility  float32  = 1.5
+	physicsSubsteps          = 1 // Number of parts each fixed physics step is split into, more is slower but tunnels less
+	solidLayers     []string     // Names of tile layers whose tiles creatures can't move through, none by default so that water stays deadly instead
 )
 
 // Type uniquely defines your game type
@@ -74,45 +101,55 @@ func (ms *MapScene) Setup(world *ecs.World) {
 	common.SetBackground(color.White)
 
 	// Systems to make stuff actually happen in the world
-	physicsSystem := &chipecs.PhysicsSystem{}
 	world.AddSystem(&common.RenderSystem{})                                                                        // Render the game
 	world.AddSystem(common.NewKeyboardScroller(scrollSpeed, engo.DefaultHorizontalAxis, engo.DefaultVerticalAxis)) // Use WASD to move the camera
 	world.AddSystem(&common.MouseZoomer{ZoomSpeed: zoomSpeed})                                                     // Use the scrollwheel to zoom in and out
-	world.AddSystem(physicsSystem)                                                                                 // Collide with stuff
-	world.AddSystem(&CreatureManagerSystem{MapScene: ms, MinCreatures: 300})                                       // Add and manage creatures
+	ms.addSimulationSystems(world, 300)
+	if cullRendering {
+		ms.culling = &CullingSystem{MapScene: ms}
+		world.AddSystem(ms.culling) // Only draw what the camera can see
+	}
 
 	tmxRawResource, err := engo.Files.Resource("world.tmx")
 	if err != nil {
 		panic(err)
 	}
 	tmxResource := tmxRawResource.(common.TMXResource)
-	ms.levelData = tmxResource.Level
+	level := tmxResource.Level
+	ms.tileWidth, ms.tileHeight = level.TileWidth, level.TileHeight
+	ms.width, ms.height = level.Width(), level.Height()
 
-	// Make the map for the holding the actual tile entities and extra data
-	ms.tileEntities = make(map[engo.Point]*tileEntity, 0)
+	// Make the grid for the holding the actual tile entities and extra data
+	ms.tiles = newTileGrid(ms.width, ms.height)
 
 	// Set up camera Bounds
-	common.CameraBounds = ms.levelData.Bounds()
+	common.CameraBounds = ms.bounds()
 
-	boundaries := []*chipmunk.Shape{
-		chipmunk.NewSegment(util.PntToVect(ms.levelData.Bounds().Min), vect.Vect{X: vect.Float(ms.levelData.Bounds().Max.X), Y: vect.Float(0)}, vect.Float(0)),
-		chipmunk.NewSegment(vect.Vect{X: vect.Float(ms.levelData.Bounds().Max.X), Y: vect.Float(0)}, util.PntToVect(ms.levelData.Bounds().Max), vect.Float(0)),
-		chipmunk.NewSegment(util.PntToVect(ms.levelData.Bounds().Max), vect.Vect{X: vect.Float(0), Y: vect.Float(ms.levelData.Bounds().Max.Y)}, vect.Float(0)),
-		chipmunk.NewSegment(vect.Vect{X: vect.Float(0), Y: vect.Float(ms.levelData.Bounds().Max.Y)}, util.PntToVect(ms.levelData.Bounds().Min), vect.Float(0)),
-	}
-	boundaryStaticBody := chipmunk.NewBodyStatic()
-	for _, segment := range boundaries {
-		segment.SetElasticity(0.6)
-		segment.Shape().GetAsSegment().A.Sub(vect.Vect{X: vect.Float(ms.levelData.TileHeight), Y: vect.Float(ms.levelData.TileWidth)})
-		segment.Shape().GetAsSegment().B.Sub(vect.Vect{X: vect.Float(ms.levelData.TileHeight), Y: vect.Float(ms.levelData.TileWidth)})
-		boundaryStaticBody.AddShape(segment)
+	// Tiles can also be made solid one at a time with a property in their tileset
+	solidProperties, err := readSolidTiles(filepath.Join("assets", "world.tmx"))
+	if err != nil {
+		log.Println("Couldn't read tile properties, only solidLayers will be solid:", err)
 	}
 
 	// Add all the actual tiles
-	for _, tileLayer := range ms.levelData.TileLayers {
+	var solidTiles []*tileEntity
+	for _, tileLayer := range level.TileLayers {
 		for _, tileElement := range tileLayer.Tiles {
 			if tileElement.Image != nil {
 				tile := &tileEntity{BasicEntity: ecs.NewBasic()}
+				if tileLayer.Name == spawnZoneLayer {
+					// Spawn zones are only used to place creatures, so we don't render them or let them cover up the real tile
+					tile.SpaceComponent = common.SpaceComponent{
+						Position: tileElement.Point,
+						Width:    tileElement.Width(),
+						Height:   tileElement.Height(),
+					}
+					ms.spawnZones = append(ms.spawnZones, tile)
+					continue
+				}
+				if x, y := ms.cell(tileElement.Point); isSolidLayer(tileLayer.Name) || solidProperties.solid(tileLayer.Name, x, y) {
+					solidTiles = append(solidTiles, tile)
+				}
 
 				switch tileLayer.Name {
 				case "Water Layer":
@@ -123,7 +160,7 @@ func (ms *MapScene) Setup(world *ecs.World) {
 				case "Food Layer":
 					tile.RenderComponent.SetZIndex(0) // Lowest Z-Index but functionally the same as Z-Index 1
 					// Loop over the the Water Layer and find the closest water tiles (not dependent on Water Layer entities existing)
-					for _, layer := range ms.levelData.TileLayers {
+					for _, layer := range level.TileLayers {
 						if layer.Name == "Water Layer" {
 							var minDistance float32
 							for _, t := range layer.Tiles {
@@ -140,8 +177,7 @@ func (ms *MapScene) Setup(world *ecs.World) {
 								}
 							}
 							// Actually set the values we've caluclated
-							tile.foodComponent.waterDistance = minDistance
-							tile.foodComponent.foodStored = (1 / minDistance) * worldFertility
+							tile.foodComponent.setWaterDistance(minDistance)
 						}
 					}
 					if tile.foodComponent.waterDistance == 0.0 { // This shouldn't happen unless the tilemap is screwed up
@@ -157,8 +193,7 @@ func (ms *MapScene) Setup(world *ecs.World) {
 
 				// Make the food tiles varying shades of green, based upon their foodStored
 				if tileLayer.Name == "Food Layer" {
-					mod := uint8((tile.foodComponent.foodStored / worldFertility) * 200)
-					tile.RenderComponent.Color = color.RGBA{0, mod, 0, 255}
+					tile.RenderComponent.Color = tile.foodComponent.color()
 				}
 
 				tile.SpaceComponent = common.SpaceComponent{
@@ -167,17 +202,13 @@ func (ms *MapScene) Setup(world *ecs.World) {
 					Height:   tileElement.Height(),
 				}
 
-				_, exists := ms.tileEntities[tileElement.Point]
-				if exists {
-					log.Println("Overlapping tiles detected at", tileElement.Point)
-				}
-				ms.tileEntities[tileElement.Point] = tile
+				ms.setTile(tile)
 			}
 		}
 	}
 
 	// Do the same for all image layers (there probably won't be any in this case)
-	for _, imageLayer := range ms.levelData.ImageLayers {
+	for _, imageLayer := range level.ImageLayers {
 		for _, imageElement := range imageLayer.Images {
 			if imageElement.Image != nil {
 				tile := &tileEntity{BasicEntity: ecs.NewBasic()}
@@ -191,31 +222,197 @@ func (ms *MapScene) Setup(world *ecs.World) {
 					Height:   imageElement.Height(),
 				}
 
-				ms.tileEntities[imageElement.Point] = tile
+				ms.setTile(tile)
 			}
 		}
 	}
 
+	ms.addTiles(world, solidTiles)
+}
+
+// addSimulationSystems adds the systems that run the simulation itself, none of which need a window
+// minCreatures is the population that the CreatureManagerSystem keeps topped up
+func (ms *MapScene) addSimulationSystems(world *ecs.World, minCreatures int) {
+	world.AddSystem(&chipecs.PhysicsSystem{Substeps: physicsSubsteps}) // Collide with stuff
+	ms.creatureManager = &CreatureManagerSystem{MapScene: ms, MinCreatures: minCreatures}
+	world.AddSystem(ms.creatureManager) // Add and manage creatures
+	if speciesThreshold > 0 {
+		world.AddSystem(&SpeciationSystem{Interval: speciesInterval, Threshold: speciesThreshold, CreatureManager: ms.creatureManager}) // Cluster creatures into species
+	}
+	if statisticsPath != "" {
+		statsWriter, err := openStatisticsWriter(statisticsPath, statisticsFormat)
+		if err != nil {
+			panic(err)
+		}
+		ms.statistics = &StatisticsSystem{Interval: statisticsInterval, Writer: statsWriter, CreatureManager: ms.creatureManager, MapScene: ms}
+		world.AddSystem(ms.statistics) // Record how the population changes
+	}
+}
+
+// addTiles walls in the map, merges solidTiles into static geometry, and adds every tile in tileEntities to the world
+// The map's size and tileEntities have to be set up before this is called
+func (ms *MapScene) addTiles(world *ecs.World, solidTiles []*tileEntity) {
+	boundaries := []*chipmunk.Shape{
+		chipmunk.NewSegment(util.PntToVect(ms.bounds().Min), vect.Vect{X: vect.Float(ms.bounds().Max.X), Y: vect.Float(0)}, vect.Float(0)),
+		chipmunk.NewSegment(vect.Vect{X: vect.Float(ms.bounds().Max.X), Y: vect.Float(0)}, util.PntToVect(ms.bounds().Max), vect.Float(0)),
+		chipmunk.NewSegment(util.PntToVect(ms.bounds().Max), vect.Vect{X: vect.Float(0), Y: vect.Float(ms.bounds().Max.Y)}, vect.Float(0)),
+		chipmunk.NewSegment(vect.Vect{X: vect.Float(0), Y: vect.Float(ms.bounds().Max.Y)}, util.PntToVect(ms.bounds().Min), vect.Float(0)),
+	}
+	ms.boundary, ms.solid = ecs.NewBasic(), ecs.NewBasic()
+	boundaryStaticBody := chipmunk.NewBodyStatic()
+	for _, segment := range boundaries {
+		segment.SetElasticity(0.6)
+		segment.Shape().GetAsSegment().A.Sub(vect.Vect{X: vect.Float(ms.tileHeight), Y: vect.Float(ms.tileWidth)})
+		segment.Shape().GetAsSegment().B.Sub(vect.Vect{X: vect.Float(ms.tileHeight), Y: vect.Float(ms.tileWidth)})
+		boundaryStaticBody.AddShape(segment)
+	}
+
+	solidStaticBody := ms.mergeSolidTiles(solidTiles)
+
+	ms.tiles.each(func(t *tileEntity) {
+		if !t.deadly && t.Shape == nil {
+			ms.habitableTiles = append(ms.habitableTiles, t)
+		}
+	})
+
 	for _, system := range world.Systems() {
 		switch sys := system.(type) {
 		case *common.RenderSystem:
-			for _, v := range ms.tileEntities { // Add all of the tiles/imageLayers
+			ms.tiles.each(func(v *tileEntity) { // Add all of the tiles/imageLayers
 				sys.Add(&v.BasicEntity, &v.RenderComponent, &v.SpaceComponent)
-			}
+			})
 		case *chipecs.PhysicsSystem:
-			sys.Space.AddBody(boundaryStaticBody)
+			sys.AddStatic(&ms.boundary, boundaryStaticBody, chipecs.CollisionFilter{Category: chipecs.CategoryWall})
+			sys.AddStatic(&ms.solid, solidStaticBody, chipecs.CollisionFilter{Category: chipecs.CategoryWall})
+		}
+	}
+}
+
+// isSolidLayer tells us if the tile layer called name is one of solidLayers
+func isSolidLayer(name string) bool {
+	for _, solid := range solidLayers {
+		if name == solid {
+			return true
 		}
 	}
+	return false
 }
 
+// mergeSolidTiles covers tiles with as few static boxes as possible, so that the physics engine
+// doesn't have to deal with a shape for every tile, and sets each tile's PhysicsComponent to the box that covers it
+func (ms *MapScene) mergeSolidTiles(tiles []*tileEntity) *chipmunk.Body {
+	grid := make([][]bool, ms.height)
+	for y := range grid {
+		grid[y] = make([]bool, ms.width)
+	}
+	cells := make(map[image.Point][]*tileEntity, len(tiles)) // Solid layers can overlap, so a cell can have more than one tile
+	for _, t := range tiles {
+		cell := image.Pt(int(t.Position.X)/ms.tileWidth, int(t.Position.Y)/ms.tileHeight)
+		if cell.Y < 0 || cell.Y >= len(grid) || cell.X < 0 || cell.X >= len(grid[cell.Y]) {
+			log.Println("Solid tile outside of the map at", t.Position)
+			continue
+		}
+		grid[cell.Y][cell.X] = true
+		cells[cell] = append(cells[cell], t)
+	}
+
+	body := chipmunk.NewBodyStatic()
+	for _, r := range util.MergeRects(grid) {
+		width := float32(r.Dx() * ms.tileWidth)
+		height := float32(r.Dy() * ms.tileHeight)
+		center := vect.Vect{
+			X: vect.Float(float32(r.Min.X*ms.tileWidth) + width/2),
+			Y: vect.Float(float32(r.Min.Y*ms.tileHeight) + height/2),
+		}
+		box := chipmunk.NewBox(center, vect.Float(width), vect.Float(height))
+		box.SetElasticity(0.6)
+		body.AddShape(box)
+
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				for _, t := range cells[image.Pt(x, y)] {
+					t.PhysicsComponent = chipecs.PhysicsComponent{
+						Shape:           box,
+						CollisionFilter: chipecs.CollisionFilter{Category: chipecs.CategoryWall},
+					}
+				}
+			}
+		}
+	}
+	return body
+}
+
+// bounds is the area covered by the map in pixels
+func (ms *MapScene) bounds() engo.AABB {
+	return engo.AABB{Max: engo.Point{X: float32(ms.width * ms.tileWidth), Y: float32(ms.height * ms.tileHeight)}}
+}
+
+// finish is called once the game has exited, it writes out everything that's saved at the end of a run
+func (ms *MapScene) finish() {
+	if ms.statistics != nil {
+		if err := ms.statistics.Close(); err != nil {
+			log.Println("Couldn't close statistics:", err)
+		}
+	}
+	ms.exportLineage()
+}
+
+// exportLineage writes the lineage of every creature to lineagePath, if it's set
+func (ms *MapScene) exportLineage() {
+	if lineagePath == "" || ms.creatureManager == nil {
+		return
+	}
+	lineage := ms.creatureManager.Lineage
+	if living := lineage.living(); len(living) > 0 {
+		if ancestor, ok := lineage.commonAncestor(living); ok {
+			log.Println("Most recent common ancestor of the", len(living), "surviving creatures is", ancestor)
+		} else {
+			log.Println("The", len(living), "surviving creatures have no common ancestor")
+		}
+	}
+	if err := lineage.export(lineagePath, lineageFormat); err != nil {
+		log.Println("Couldn't export lineage:", err)
+	}
+}
+
+// offMapTile is what getTileEntityAt returns for places without a tile, nonexistant tiles are deadly
+// It's shared, but since it's deadly nothing ever gets stored on it
+var offMapTile = &tileEntity{foodComponent: foodComponent{deadly: true}}
+
+// getTileEntityAt finds the tile containing p, or offMapTile if there isn't one
 func (ms *MapScene) getTileEntityAt(p engo.Point) *tileEntity {
-	closestTilePoint := engo.Point{}
-	closestTilePoint.X = float32((int(p.X) / ms.levelData.TileWidth) * ms.levelData.TileWidth)
-	closestTilePoint.Y = float32((int(p.Y) / ms.levelData.TileHeight) * ms.levelData.TileHeight)
-	_, exists := ms.tileEntities[closestTilePoint]
-	if !exists {
-		log.Println("Get of a nonexistant tile at", closestTilePoint)
-		return &tileEntity{foodComponent: foodComponent{deadly: true}} // Nonexistant tiles are deadly
-	}
-	return ms.tileEntities[closestTilePoint]
+	if tile, exists := ms.tileAt(p); exists {
+		return tile
+	}
+	return offMapTile
+}
+
+// tileAt finds the tile containing p, exists is false if there isn't one
+func (ms *MapScene) tileAt(p engo.Point) (tile *tileEntity, exists bool) {
+	x, y := ms.cell(p)
+	return ms.tiles.at(x, y)
+}
+
+// cell finds the grid coordinates of the tile containing p
+func (ms *MapScene) cell(p engo.Point) (x, y int) {
+	return int(math.Floor(float64(p.X) / float64(ms.tileWidth))), int(math.Floor(float64(p.Y) / float64(ms.tileHeight)))
+}
+
+// setTile puts tile into the grid at the cell its position is in, replacing whatever was there
+func (ms *MapScene) setTile(tile *tileEntity) {
+	x, y := ms.cell(tile.Position)
+	if _, exists := ms.tiles.at(x, y); exists {
+		log.Println("Overlapping tiles detected at", tile.Position)
+	}
+	if !ms.tiles.set(x, y, tile) {
+		log.Println("Tile outside of the map at", tile.Position)
+	}
+}
+
+// validatePhysicsFlags checks the physics tunables
+func validatePhysicsFlags() error {
+	if physicsSubsteps < 1 {
+		return fmt.Errorf("-physics-substeps must be at least 1, got %v", physicsSubsteps)
+	}
+	return nil
 }
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"math"
+
+	"engo.io/engo"
+)
+
+var creatureHashCellSize float32 = 128 // Width and height of each cell in the creature spatial hash, in pixels
+
+// tileGrid holds the tiles of a map in a slice, indexed by their integer cell coordinates
+type tileGrid struct {
+	width, height int
+	tiles         []*tileEntity // Row major, nil where there's no tile
+}
+
+// newTileGrid makes an empty tileGrid that's width by height cells
+func newTileGrid(width, height int) tileGrid {
+	return tileGrid{width: width, height: height, tiles: make([]*tileEntity, width*height)}
+}
+
+// at returns the tile in cell x, y, exists is false if there isn't one or the cell is off the grid
+func (g *tileGrid) at(x, y int) (tile *tileEntity, exists bool) {
+	if x < 0 || y < 0 || x >= g.width || y >= g.height {
+		return nil, false
+	}
+	tile = g.tiles[y*g.width+x]
+	return tile, tile != nil
+}
+
+// set puts tile in cell x, y, replacing anything that was already there
+// ok is false if the cell is off the grid, in which case nothing is stored
+func (g *tileGrid) set(x, y int, tile *tileEntity) (ok bool) {
+	if x < 0 || y < 0 || x >= g.width || y >= g.height {
+		return false
+	}
+	g.tiles[y*g.width+x] = tile
+	return true
+}
+
+// each calls fn on every tile in the grid, row by row
+func (g *tileGrid) each(fn func(t *tileEntity)) {
+	for _, t := range g.tiles {
+		if t != nil {
+			fn(t)
+		}
+	}
+}
+
+// creatureHash buckets creatures by the cell their centre is in, so that we can find the ones near a point
+// without looking at every creature
+type creatureHash struct {
+	cellSize   float32
+	cols, rows int
+	cells      [][]*Creature // Row major
+	maxRadius  float32       // Radius of the biggest creature that's been inserted since the last clear
+}
+
+// newCreatureHash makes an empty creatureHash covering bounds with cells that are cellSize pixels across
+// Creatures outside of bounds go in the closest cell on its edge
+func newCreatureHash(bounds engo.AABB, cellSize float32) *creatureHash {
+	cols := int(math.Ceil(float64((bounds.Max.X - bounds.Min.X) / cellSize)))
+	rows := int(math.Ceil(float64((bounds.Max.Y - bounds.Min.Y) / cellSize)))
+	if cols < 1 {
+		cols = 1
+	}
+	if rows < 1 {
+		rows = 1
+	}
+	return &creatureHash{cellSize: cellSize, cols: cols, rows: rows, cells: make([][]*Creature, cols*rows)}
+}
+
+// cell finds the cell p is in, clamped to the edge of the hash
+func (h *creatureHash) cell(p engo.Point) (x, y int) {
+	x = int(math.Floor(float64(p.X / h.cellSize)))
+	y = int(math.Floor(float64(p.Y / h.cellSize)))
+	if x < 0 {
+		x = 0
+	} else if x >= h.cols {
+		x = h.cols - 1
+	}
+	if y < 0 {
+		y = 0
+	} else if y >= h.rows {
+		y = h.rows - 1
+	}
+	return x, y
+}
+
+// clear empties the hash while keeping its memory around for the next time it's filled
+func (h *creatureHash) clear() {
+	for i := range h.cells {
+		h.cells[i] = h.cells[i][:0]
+	}
+	h.maxRadius = 0
+}
+
+// insert adds c to the cell its centre is in
+// The hash doesn't notice when c moves, so it has to be cleared and refilled every tick
+func (h *creatureHash) insert(c *Creature) {
+	x, y := h.cell(c.Center())
+	h.cells[y*h.cols+x] = append(h.cells[y*h.cols+x], c)
+	if r := c.Width / 2; r > h.maxRadius {
+		h.maxRadius = r
+	}
+}
+
+// remove takes c out of the hash, it does nothing if c isn't in it
+func (h *creatureHash) remove(c *Creature) {
+	x, y := h.cell(c.Center())
+	if h.removeFrom(y*h.cols+x, c) {
+		return
+	}
+	for i := range h.cells { // c has moved since it was inserted
+		if h.removeFrom(i, c) {
+			return
+		}
+	}
+}
+
+// removeFrom takes c out of cell i, ok is false if it wasn't there
+func (h *creatureHash) removeFrom(i int, c *Creature) (ok bool) {
+	for j, other := range h.cells[i] {
+		if other == c {
+			last := len(h.cells[i]) - 1
+			h.cells[i][j] = h.cells[i][last]
+			h.cells[i][last] = nil
+			h.cells[i] = h.cells[i][:last]
+			return true
+		}
+	}
+	return false
+}
+
+// query calls fn on every creature whose centre is in a cell that overlaps the rectangle from min to max
+// Some of them may be outside of the rectangle, so fn should check if it cares
+func (h *creatureHash) query(min, max engo.Point, fn func(c *Creature)) {
+	minX, minY := h.cell(min)
+	maxX, maxY := h.cell(max)
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			for _, c := range h.cells[y*h.cols+x] {
+				fn(c)
+			}
+		}
+	}
+}
+
+// overlapping calls fn on every creature whose circle overlaps the circle at center with radius
+func (h *creatureHash) overlapping(center engo.Point, radius float32, fn func(c *Creature)) {
+	reach := radius + h.maxRadius
+	h.query(
+		engo.Point{X: center.X - reach, Y: center.Y - reach},
+		engo.Point{X: center.X + reach, Y: center.Y + reach},
+		func(c *Creature) {
+			d := radius + c.Width/2
+			p := c.Center()
+			dx, dy := p.X-center.X, p.Y-center.Y
+			if dx*dx+dy*dy < d*d {
+				fn(c)
+			}
+		},
+	)
+}
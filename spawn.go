@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	"engo.io/engo"
+)
+
+var (
+	spawnPlacement     = "uniform"     // Where creatures without parents are placed, one of the names in spawnStrategies
+	birthPlacement     = "parents"     // Where creatures with parents are placed, one of the names in spawnStrategies
+	spawnZoneLayer     = "Spawn Layer" // Name of the tile layer that marks out spawn zones for the "zones" strategy, it isn't rendered
+	spawnAttempts      = 50            // Number of places we try before giving up on spawning a creature
+	spawnClusterCount  = 5             // Number of clusters for the "clustered" strategy
+	spawnClusterSpread = 96.0          // Standard deviation of the distance from a cluster's centre for the "clustered" strategy, in pixels
+)
+
+// spawnStrategy picks a candidate for the centre of a new creature with the given radius
+// Candidates don't have to be valid, findSpawnPoint checks them and asks for another if they aren't
+type spawnStrategy func(cm *CreatureManagerSystem, parents []*Creature, radius float32) engo.Point
+
+// spawnStrategies holds every spawnStrategy by the name used to configure it
+var spawnStrategies = map[string]spawnStrategy{
+	"uniform":   spawnUniform,
+	"parents":   spawnNearParents,
+	"clustered": spawnClustered,
+	"zones":     spawnInZones,
+}
+
+// findSpawnPoint finds somewhere to put the centre of a new creature with the given radius, using strategy
+// The point is guaranteed not to overlap with solid or deadly tiles, or with any other creature
+// ok is false if we couldn't find anywhere in spawnAttempts tries
+func (cm *CreatureManagerSystem) findSpawnPoint(strategy string, parents []*Creature, radius float32) (center engo.Point, ok bool) {
+	pick, exists := spawnStrategies[strategy]
+	if !exists {
+		pick = spawnUniform
+	}
+	for i := 0; i < spawnAttempts; i++ {
+		center = pick(cm, parents, radius)
+		if cm.canSpawnAt(center, radius) {
+			return center, true
+		}
+	}
+	return engo.Point{}, false
+}
+
+// canSpawnAt tells us if a creature with radius can be put at center without overlapping anything
+func (cm *CreatureManagerSystem) canSpawnAt(center engo.Point, radius float32) bool {
+	// Check every tile under the creature's bounding box
+	ms := cm.MapScene
+	tileWidth, tileHeight := float32(ms.tileWidth), float32(ms.tileHeight)
+	for y := center.Y - radius; y < center.Y+radius+tileHeight; y += tileHeight {
+		for x := center.X - radius; x < center.X+radius+tileWidth; x += tileWidth {
+			p := engo.Point{X: float32(math.Min(float64(x), float64(center.X+radius))), Y: float32(math.Min(float64(y), float64(center.Y+radius)))}
+			tile, exists := ms.tileAt(p)
+			if !exists || tile.deadly || tile.Shape != nil {
+				return false
+			}
+		}
+	}
+
+	// Then check for other creatures, which are the only other bodies that move around
+	overlaps := false
+	if cm.hash != nil {
+		cm.hash.overlapping(center, radius, func(*Creature) { overlaps = true })
+	}
+	return !overlaps
+}
+
+// spawnUniform picks a point uniformly at random from the habitable tiles
+func spawnUniform(cm *CreatureManagerSystem, parents []*Creature, radius float32) engo.Point {
+	return randomPointIn(cm.rng, cm.MapScene.habitableTiles)
+}
+
+// spawnNearParents picks a point just outside of a random parent, or uses spawnUniform if there aren't any parents
+func spawnNearParents(cm *CreatureManagerSystem, parents []*Creature, radius float32) engo.Point {
+	if len(parents) == 0 {
+		return spawnUniform(cm, parents, radius)
+	}
+	p := parents[cm.rng.Intn(len(parents))]
+	distance := float64(p.Width/2 + radius + cm.rng.Float32()*radius)
+	sin, cos := math.Sincos(cm.rng.Float64() * 2 * math.Pi)
+	center := p.Center()
+	return engo.Point{X: center.X + float32(cos*distance), Y: center.Y + float32(sin*distance)}
+}
+
+// spawnClustered picks a point normally distributed around one of spawnClusterCount cluster centres,
+// which are picked from the habitable tiles the first time they're needed
+func spawnClustered(cm *CreatureManagerSystem, parents []*Creature, radius float32) engo.Point {
+	for len(cm.spawnClusters) < spawnClusterCount {
+		cm.spawnClusters = append(cm.spawnClusters, randomPointIn(cm.rng, cm.MapScene.habitableTiles))
+	}
+	c := cm.spawnClusters[cm.rng.Intn(len(cm.spawnClusters))]
+	return engo.Point{
+		X: c.X + float32(cm.rng.NormFloat64()*spawnClusterSpread),
+		Y: c.Y + float32(cm.rng.NormFloat64()*spawnClusterSpread),
+	}
+}
+
+// spawnInZones picks a point uniformly at random from the tiles in spawnZoneLayer, or uses spawnUniform if there aren't any
+func spawnInZones(cm *CreatureManagerSystem, parents []*Creature, radius float32) engo.Point {
+	if len(cm.MapScene.spawnZones) == 0 {
+		return spawnUniform(cm, parents, radius)
+	}
+	return randomPointIn(cm.rng, cm.MapScene.spawnZones)
+}
+
+// randomPointIn uses r to pick a random point inside of a random tile from tiles
+func randomPointIn(r *rand.Rand, tiles []*tileEntity) engo.Point {
+	if len(tiles) == 0 {
+		return engo.Point{}
+	}
+	t := tiles[r.Intn(len(tiles))]
+	return engo.Point{
+		X: t.Position.X + r.Float32()*t.Width,
+		Y: t.Position.Y + r.Float32()*t.Height,
+	}
+}
+
+// spawnStrategyNames returns the name of every spawnStrategy in alphabetical order
+func spawnStrategyNames() []string {
+	names := make([]string, 0, len(spawnStrategies))
+	for name := range spawnStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateSpawnFlags checks that both placements name a spawnStrategy
+func validateSpawnFlags() error {
+	if err := checkChoice("spawn", spawnPlacement, spawnStrategyNames()...); err != nil {
+		return err
+	}
+	return checkChoice("birth-spawn", birthPlacement, spawnStrategyNames()...)
+}
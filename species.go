@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"math"
+	"sort"
+
+	"engo.io/ecs"
+	"engo.io/engo"
+)
+
+var (
+	speciesThreshold float32 // Maximum genome distance between a creature and the representative of its species, 0 (the default until it has been tuned) turns speciation off
+	speciesInterval  = 30    // Number of ticks between each reclustering of the population into species
+)
+
+// SpeciesBirthMessage is dispatched whenever a new species appears
+type SpeciesBirthMessage struct {
+	SpeciesID int
+	Tick      int
+}
+
+// Type implements the engo.Message interface
+func (SpeciesBirthMessage) Type() string { return "SpeciesBirthMessage" }
+
+// SpeciesExtinctionMessage is dispatched whenever the last member of a species is gone
+type SpeciesExtinctionMessage struct {
+	SpeciesID int
+	Tick      int
+	// Age is the number of ticks the species existed for
+	Age int
+}
+
+// Type implements the engo.Message interface
+func (SpeciesExtinctionMessage) Type() string { return "SpeciesExtinctionMessage" }
+
+// species is a cluster of creatures with similar genomes
+type species struct {
+	id             int
+	representative []float32 // The mean genome of the members, as of the last reclustering
+	color          color.RGBA
+	birthTick      int
+}
+
+// SpeciationSystem clusters creatures into species by the distance between their genomes
+// Species keep their IDs for as long as they have members
+// This type implements the engo.System interface
+type SpeciationSystem struct {
+	// Interval is the number of ticks between each reclustering
+	Interval int
+	// Threshold is the maximum genome distance between a creature and the representative of its species
+	Threshold float32
+	// CreatureManager is the system that holds the creatures we're clustering
+	CreatureManager *CreatureManagerSystem
+
+	species []*species // Ordered by ID so that assignment is deterministic
+	nextID  int
+	tick    int
+}
+
+// genome returns the weights of the creature's brain followed by its traits in a fixed order, so that genomes can be compared
+func (c *Creature) genome() []float32 {
+	g := make([]float32, 0, len(networkOutputs)+len(c.HiddenLayer)+1)
+	for _, axon := range c.Output {
+		g = append(g, axon.Weight)
+	}
+	for _, axon := range c.HiddenLayer {
+		g = append(g, axon.Weight)
+	}
+	return append(g, c.TraitComponent.traits()...)
+}
+
+// genomeDistance is the Euclidean distance between two genomes
+// Genes that only one of the genomes has are compared against 0
+func genomeDistance(a, b []float32) float32 {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	var sum float64
+	for i := range a {
+		var other float32
+		if i < len(b) {
+			other = b[i]
+		}
+		d := float64(a[i] - other)
+		sum += d * d
+	}
+	return float32(math.Sqrt(sum))
+}
+
+// New is called when the SpeciationSystem is added to the scene
+func (ss *SpeciationSystem) New(*ecs.World) {
+	ss.nextID = 1 // A SpeciesID of 0 means that a creature hasn't been assigned a species yet
+	engo.Mailbox.Listen("CreatureBirthMessage", func(message engo.Message) {
+		if m, ok := message.(CreatureBirthMessage); ok {
+			ss.assign(m.Creature)
+		}
+	})
+	log.Println("SpeciationSystem was added to the scene.")
+}
+
+// Remove is called when an entity is removed, extinction is handled when we recluster so we do nothing
+func (ss *SpeciationSystem) Remove(ecs.BasicEntity) {}
+
+// Update is called every frame
+func (ss *SpeciationSystem) Update(dt float32) {
+	ss.tick++
+	if ss.Interval <= 0 || ss.tick%ss.Interval != 0 {
+		return
+	}
+	ss.recluster()
+}
+
+// assign puts c into its current species if it's still close enough, otherwise the closest species
+// within Threshold, otherwise a brand new species
+func (ss *SpeciationSystem) assign(c *Creature) {
+	g := c.genome()
+
+	var closest *species
+	closestDistance := ss.Threshold
+	for _, s := range ss.species {
+		d := genomeDistance(g, s.representative)
+		if s.id == c.SpeciesID && d <= ss.Threshold {
+			closest = s
+			break
+		}
+		if d <= closestDistance {
+			closest = s
+			closestDistance = d
+		}
+	}
+
+	if closest == nil {
+		closest = &species{
+			id:             ss.nextID,
+			representative: g,
+			color:          speciesColor(ss.nextID),
+			birthTick:      ss.CreatureManager.Tick,
+		}
+		ss.nextID++
+		ss.species = append(ss.species, closest)
+		engo.Mailbox.Dispatch(SpeciesBirthMessage{SpeciesID: closest.id, Tick: closest.birthTick})
+	}
+
+	c.SpeciesID = closest.id
+	if colorBy == "species" {
+		c.RenderComponent.Color = closest.color
+	}
+}
+
+// recluster reassigns every creature to a species, moves every representative to the mean genome
+// of its members, and removes species that have no members left
+func (ss *SpeciationSystem) recluster() {
+	ids := make([]uint64, 0, len(ss.CreatureManager.Creatures))
+	for id := range ss.CreatureManager.Creatures {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	sums := make(map[int][]float32)
+	counts := make(map[int]int)
+	for _, id := range ids {
+		c := ss.CreatureManager.Creatures[id]
+		ss.assign(c)
+		g := c.genome()
+		sum := sums[c.SpeciesID]
+		for len(sum) < len(g) {
+			sum = append(sum, 0)
+		}
+		for i := range g {
+			sum[i] += g[i]
+		}
+		sums[c.SpeciesID] = sum
+		counts[c.SpeciesID]++
+	}
+
+	alive := ss.species[:0]
+	for _, s := range ss.species {
+		if counts[s.id] == 0 {
+			engo.Mailbox.Dispatch(SpeciesExtinctionMessage{
+				SpeciesID: s.id,
+				Tick:      ss.CreatureManager.Tick,
+				Age:       ss.CreatureManager.Tick - s.birthTick,
+			})
+			continue
+		}
+		for i := range sums[s.id] {
+			sums[s.id][i] /= float32(counts[s.id])
+		}
+		s.representative = sums[s.id]
+		alive = append(alive, s)
+	}
+	ss.species = alive
+}
+
+// speciesColor picks a colour for the species with id, spreading hues out using the golden ratio
+// so that species with nearby IDs are easy to tell apart
+func speciesColor(id int) color.RGBA {
+	hue := math.Mod(float64(id)*0.618033988749895, 1) * 6
+	x := uint8(255 * (1 - math.Abs(math.Mod(hue, 2)-1)))
+	switch int(hue) {
+	case 0:
+		return color.RGBA{255, x, 0, 200}
+	case 1:
+		return color.RGBA{x, 255, 0, 200}
+	case 2:
+		return color.RGBA{0, 255, x, 200}
+	case 3:
+		return color.RGBA{0, x, 255, 200}
+	case 4:
+		return color.RGBA{x, 0, 255, 200}
+	}
+	return color.RGBA{255, 0, x, 200}
+}
+
+// validateSpeciesFlags checks the speciation tunables
+func validateSpeciesFlags() error {
+	if speciesThreshold < 0 {
+		return fmt.Errorf("-species-threshold must not be negative, got %v", speciesThreshold)
+	}
+	if speciesInterval <= 0 {
+		return fmt.Errorf("-species-interval must be positive, got %v", speciesInterval)
+	}
+	return nil
+}
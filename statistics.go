@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+
+	"engo.io/ecs"
+	"engo.io/engo"
+)
+
+var (
+	statisticsPath     string  // Where to write statistics to, nothing gets recorded if this is empty
+	statisticsFormat   = "csv" // Either "csv" or "jsonl"
+	statisticsInterval = 60    // Number of ticks between each recorded snapshot
+)
+
+// CreatureBirthMessage is dispatched whenever a creature is added to the world
+type CreatureBirthMessage struct {
+	Creature *Creature
+}
+
+// Type implements the engo.Message interface
+func (CreatureBirthMessage) Type() string { return "CreatureBirthMessage" }
+
+// CreatureDeathMessage is dispatched whenever a creature is removed from the world
+type CreatureDeathMessage struct {
+	Creature *Creature
+	// Cause is a short description of what killed the creature, it should be one of deathCauses
+	Cause string
+	// Age is the number of ticks the creature was alive for
+	Age int
+	// FoodEaten is the total amount of food the creature ate over its lifetime, including food taken by attacking
+	FoodEaten float32
+}
+
+// Type implements the engo.Message interface
+func (CreatureDeathMessage) Type() string { return "CreatureDeathMessage" }
+
+// populationStatistics is a snapshot of the population at a single tick
+type populationStatistics struct {
+	Tick          int                `json:"tick"`
+	Population    int                `json:"population"`
+	Species       int                `json:"species"`         // Number of distinct species in the population, 0 if speciation is off
+	Births        int                `json:"births"`          // Births since the last snapshot, including creatures that were spawned in
+	AsexualBirths int                `json:"asexual_births"`  // Births since the last snapshot from a single parent dividing
+	Deaths        map[string]int     `json:"deaths"`          // Deaths since the last snapshot, keyed by cause
+	MeanDeathAge  float32            `json:"mean_death_age"`  // Mean age of the creatures that died since the last snapshot
+	MeanDeathFood float32            `json:"mean_death_food"` // Mean lifetime food eaten by the creatures that died since the last snapshot
+	MeanAge       float32            `json:"mean_age"`        // Mean age of the living population
+	MeanFood      float32            `json:"mean_food"`       // Mean StoredFood
+	MinFood       float32            `json:"min_food"`        // Minimum StoredFood
+	MaxFood       float32            `json:"max_food"`        // Maximum StoredFood
+	MeanOutputs   map[string]float32 `json:"mean_outputs"`    // Mean value of every network output, keyed by output name
+	EnergyFlows   map[string]float32 `json:"energy_flows"`    // Food gained or spent in each energy category over the last tick, summed over the population
+	TileFoodTotal float32            `json:"tile_food_total"` // Sum of foodStored over every tile
+}
+
+// statisticsWriter writes snapshots to some underlying file format
+type statisticsWriter interface {
+	Write(populationStatistics) error
+	// Close flushes anything that hasn't been written yet, and closes the underlying file if there is one
+	Close() error
+}
+
+// StatisticsSystem records a snapshot of the population every Interval ticks
+// This type implements the engo.System interface
+type StatisticsSystem struct {
+	// Interval is the number of ticks between each recorded snapshot
+	Interval int
+	// Writer is where snapshots are written
+	Writer statisticsWriter
+	// CreatureManager is the system that holds the creatures we're recording
+	CreatureManager *CreatureManagerSystem
+	// MapScene holds a pointer to the map scene so that we can total up tile food
+	MapScene *MapScene
+
+	tick          int
+	births        int
+	asexualBirths int
+	deaths        map[string]int
+	deathAges     int
+	deathFoods    float32
+}
+
+// newStatisticsWriter makes a statisticsWriter that writes to w in the given format
+// If w is also an io.Closer then closing the statisticsWriter closes w
+func newStatisticsWriter(w io.Writer, format string) (statisticsWriter, error) {
+	closer, _ := w.(io.Closer)
+	switch format {
+	case "csv":
+		return &csvStatisticsWriter{w: csv.NewWriter(w), closer: closer}, nil
+	case "jsonl":
+		return &jsonLinesStatisticsWriter{enc: json.NewEncoder(w), closer: closer}, nil
+	}
+	return nil, fmt.Errorf("unknown statistics format %q", format)
+}
+
+// openStatisticsWriter creates the file at path and returns a statisticsWriter for it
+func openStatisticsWriter(path, format string) (statisticsWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	sw, err := newStatisticsWriter(f, format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return sw, nil
+}
+
+// New is called when the StatisticsSystem is added to the scene
+func (ss *StatisticsSystem) New(*ecs.World) {
+	ss.deaths = make(map[string]int)
+	engo.Mailbox.Listen("CreatureBirthMessage", func(message engo.Message) {
+		if m, ok := message.(CreatureBirthMessage); ok {
+			ss.births++
+			if len(m.Creature.Parents) == 1 {
+				ss.asexualBirths++
+			}
+		}
+	})
+	engo.Mailbox.Listen("CreatureDeathMessage", func(message engo.Message) {
+		if m, ok := message.(CreatureDeathMessage); ok {
+			ss.deaths[m.Cause]++
+			ss.deathAges += m.Age
+			ss.deathFoods += m.FoodEaten
+		}
+	})
+	log.Println("StatisticsSystem was added to the scene.")
+}
+
+// Remove is called when an entity is removed, we don't track any entities so we do nothing
+func (ss *StatisticsSystem) Remove(ecs.BasicEntity) {}
+
+// Close closes Writer, after which nothing else gets recorded
+// It should be called once the game exits so that the last snapshots aren't lost
+func (ss *StatisticsSystem) Close() error {
+	if ss.Writer == nil {
+		return nil
+	}
+	err := ss.Writer.Close()
+	ss.Writer = nil
+	return err
+}
+
+// Update is called every frame
+func (ss *StatisticsSystem) Update(dt float32) {
+	ss.tick++
+	if ss.Writer == nil || ss.Interval <= 0 || ss.tick%ss.Interval != 0 {
+		return
+	}
+
+	if err := ss.Writer.Write(ss.snapshot()); err != nil {
+		log.Println("Couldn't write statistics:", err)
+	}
+	ss.births = 0
+	ss.asexualBirths = 0
+	ss.deaths = make(map[string]int)
+	ss.deathAges = 0
+	ss.deathFoods = 0
+}
+
+// snapshot collects the statistics for the current tick
+func (ss *StatisticsSystem) snapshot() populationStatistics {
+	stats := populationStatistics{
+		Tick:          ss.tick,
+		Population:    len(ss.CreatureManager.Creatures),
+		Births:        ss.births,
+		AsexualBirths: ss.asexualBirths,
+		Deaths:        ss.deaths,
+		MeanOutputs:   make(map[string]float32, len(networkOutputs)),
+		EnergyFlows:   make(map[string]float32, int(energyCategoryCount)),
+	}
+
+	var deathCount int
+	for _, n := range ss.deaths {
+		deathCount += n
+	}
+	if deathCount > 0 {
+		stats.MeanDeathAge = float32(ss.deathAges) / float32(deathCount)
+		stats.MeanDeathFood = ss.deathFoods / float32(deathCount)
+	}
+
+	if stats.Population > 0 {
+		stats.MinFood = math.MaxFloat32
+		speciesSeen := make(map[int]bool)
+		for _, c := range ss.CreatureManager.Creatures {
+			if c.SpeciesID != 0 && !speciesSeen[c.SpeciesID] { // 0 means no species, which is all there is if speciation is off
+				speciesSeen[c.SpeciesID] = true
+				stats.Species++
+			}
+			stats.MeanAge += float32(c.Age)
+			stats.MeanFood += c.StoredFood
+			stats.MinFood = float32(math.Min(float64(stats.MinFood), float64(c.StoredFood)))
+			stats.MaxFood = float32(math.Max(float64(stats.MaxFood), float64(c.StoredFood)))
+			for k, name := range networkOutputs {
+				stats.MeanOutputs[name] += c.Output[k].Value
+			}
+			for cat := energyCategory(0); cat < energyCategoryCount; cat++ {
+				stats.EnergyFlows[cat.String()] += c.LastTick.Income[cat] + c.LastTick.Expenditure[cat]
+			}
+		}
+		stats.MeanAge /= float32(stats.Population)
+		stats.MeanFood /= float32(stats.Population)
+		for name := range stats.MeanOutputs {
+			stats.MeanOutputs[name] /= float32(stats.Population)
+		}
+	}
+
+	ss.MapScene.tiles.each(func(t *tileEntity) {
+		stats.TileFoodTotal += t.foodStored + t.carcassFood
+	})
+	return stats
+}
+
+// csvStatisticsWriter writes snapshots as CSV, with a header before the first row
+type csvStatisticsWriter struct {
+	w           *csv.Writer
+	closer      io.Closer // Closed along with the writer, may be nil
+	wroteHeader bool
+}
+
+// Write implements statisticsWriter
+func (cw *csvStatisticsWriter) Write(stats populationStatistics) error {
+	if !cw.wroteHeader {
+		header := []string{"tick", "population", "species", "births", "asexual_births"}
+		for _, cause := range deathCauses {
+			header = append(header, "deaths_"+cause)
+		}
+		header = append(header, "mean_death_age", "mean_death_food", "mean_age", "mean_food", "min_food", "max_food")
+		for _, name := range networkOutputs {
+			header = append(header, "mean_output_"+name)
+		}
+		for cat := energyCategory(0); cat < energyCategoryCount; cat++ {
+			header = append(header, "energy_"+cat.String())
+		}
+		header = append(header, "tile_food_total")
+		if err := cw.w.Write(header); err != nil {
+			return err
+		}
+		cw.wroteHeader = true
+	}
+
+	formatFloat := func(f float32) string { return strconv.FormatFloat(float64(f), 'g', -1, 32) }
+	row := []string{strconv.Itoa(stats.Tick), strconv.Itoa(stats.Population), strconv.Itoa(stats.Species), strconv.Itoa(stats.Births), strconv.Itoa(stats.AsexualBirths)}
+	for _, cause := range deathCauses {
+		row = append(row, strconv.Itoa(stats.Deaths[cause]))
+	}
+	row = append(row, formatFloat(stats.MeanDeathAge), formatFloat(stats.MeanDeathFood), formatFloat(stats.MeanAge), formatFloat(stats.MeanFood), formatFloat(stats.MinFood), formatFloat(stats.MaxFood))
+	for _, name := range networkOutputs {
+		row = append(row, formatFloat(stats.MeanOutputs[name]))
+	}
+	for cat := energyCategory(0); cat < energyCategoryCount; cat++ {
+		row = append(row, formatFloat(stats.EnergyFlows[cat.String()]))
+	}
+	row = append(row, formatFloat(stats.TileFoodTotal))
+	if err := cw.w.Write(row); err != nil {
+		return err
+	}
+	// Flush every row so that we don't lose anything when the window gets closed
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// Close implements statisticsWriter
+func (cw *csvStatisticsWriter) Close() error {
+	cw.w.Flush()
+	err := cw.w.Error()
+	if cw.closer != nil {
+		if closeErr := cw.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// jsonLinesStatisticsWriter writes snapshots as JSON Lines, one object per snapshot
+type jsonLinesStatisticsWriter struct {
+	enc    *json.Encoder
+	closer io.Closer // Closed along with the writer, may be nil
+}
+
+// Write implements statisticsWriter
+func (jw *jsonLinesStatisticsWriter) Write(stats populationStatistics) error {
+	return jw.enc.Encode(stats)
+}
+
+// Close implements statisticsWriter, the encoder doesn't buffer so there's nothing to flush
+func (jw *jsonLinesStatisticsWriter) Close() error {
+	if jw.closer == nil {
+		return nil
+	}
+	return jw.closer.Close()
+}
+
+// validateStatisticsFlags checks the statistics tunables
+func validateStatisticsFlags() error {
+	if statisticsInterval <= 0 {
+		return fmt.Errorf("-stats-interval must be positive, got %v", statisticsInterval)
+	}
+	return checkChoice("stats-format", statisticsFormat, "csv", "jsonl")
+}
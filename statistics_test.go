@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testStatistics is a snapshot with a different value in every field, so that misaligned columns show up
+func testStatistics() populationStatistics {
+	stats := populationStatistics{
+		Tick: 120, Population: 40, Species: 3, Births: 7, AsexualBirths: 2,
+		Deaths:       map[string]int{causeStarvation: 4, causePredation: 1},
+		MeanDeathAge: 55.5, MeanDeathFood: 9.25, MeanAge: 80, MeanFood: 6.5, MinFood: 0.5, MaxFood: 12,
+		MeanOutputs:   make(map[string]float32),
+		EnergyFlows:   make(map[string]float32),
+		TileFoodTotal: 1234.5,
+	}
+	for i, name := range networkOutputs {
+		stats.MeanOutputs[name] = float32(i) + 0.25
+	}
+	for cat := energyCategory(0); cat < energyCategoryCount; cat++ {
+		stats.EnergyFlows[cat.String()] = float32(cat) * 10
+	}
+	return stats
+}
+
+func TestStatisticsWriters(t *testing.T) {
+	want := testStatistics()
+	tests := []struct {
+		format string
+		check  func(t *testing.T, out string)
+	}{
+		{"csv", func(t *testing.T, out string) {
+			records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 3 {
+				t.Fatalf("got %d records, want a header and two rows", len(records))
+			}
+			columns := 5 + len(deathCauses) + 6 + len(networkOutputs) + int(energyCategoryCount) + 1
+			for i, r := range records {
+				if len(r) != columns {
+					t.Errorf("record %d has %d columns, want %d", i, len(r), columns)
+				}
+			}
+			header, row := records[0], records[1]
+			got := make(map[string]string, len(header))
+			for i, name := range header {
+				if i < len(row) {
+					got[name] = row[i]
+				}
+			}
+			for name, value := range map[string]string{
+				"tick": "120", "population": "40", "species": "3", "births": "7", "asexual_births": "2",
+				"deaths_starvation": "4", "deaths_drowning": "0", "deaths_predation": "1", "deaths_oldage": "0",
+				"mean_death_age": "55.5", "mean_death_food": "9.25", "mean_age": "80", "mean_food": "6.5", "min_food": "0.5", "max_food": "12",
+				"mean_output_thrust": "0.25", "mean_output_divide": "5.25",
+				"energy_plants": "0", "energy_division": "120",
+				"tile_food_total": "1234.5",
+			} {
+				if got[name] != value {
+					t.Errorf("column %s = %q, want %q", name, got[name], value)
+				}
+			}
+		}},
+		{"jsonl", func(t *testing.T, out string) {
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("got %d lines, want 2", len(lines))
+			}
+			var got populationStatistics
+			if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			sw, err := newStatisticsWriter(&buf, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				if err := sw.Write(testStatistics()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := sw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, buf.String())
+		})
+	}
+
+	if _, err := newStatisticsWriter(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("newStatisticsWriter accepted an unknown format")
+	}
+}
+
+func TestStatisticsSnapshot(t *testing.T) {
+	_, ms := newTestScene(t, 32, 0, 1)
+	cm := ms.creatureManager
+	for _, food := range []float32{4, 8, 12} {
+		if cm.spawnCreature(food) == nil {
+			t.Fatal("no room for a creature")
+		}
+	}
+	ss := &StatisticsSystem{CreatureManager: cm, MapScene: ms, deaths: map[string]int{causeStarvation: 2}, deathAges: 30, deathFoods: 5}
+
+	stats := ss.snapshot()
+	if stats.Population != 3 || stats.Species != 0 {
+		t.Errorf("population %d in %d species, want 3 in none because speciation is off", stats.Population, stats.Species)
+	}
+	if stats.MinFood != 4 || stats.MaxFood != 12 || stats.MeanFood != 8 {
+		t.Errorf("food min %v, max %v, mean %v, want 4, 12 and 8", stats.MinFood, stats.MaxFood, stats.MeanFood)
+	}
+	if stats.MeanDeathAge != 15 || stats.MeanDeathFood != 2.5 {
+		t.Errorf("mean death age %v and food %v, want 15 and 2.5", stats.MeanDeathAge, stats.MeanDeathFood)
+	}
+	if len(stats.MeanOutputs) != len(networkOutputs) || len(stats.EnergyFlows) != int(energyCategoryCount) {
+		t.Errorf("%d mean outputs and %d energy flows, want %d and %d", len(stats.MeanOutputs), len(stats.EnergyFlows), len(networkOutputs), energyCategoryCount)
+	}
+	if stats.TileFoodTotal <= 0 {
+		t.Errorf("tile food total is %v, want the food on the synthetic map", stats.TileFoodTotal)
+	}
+}
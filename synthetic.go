@@ -0,0 +1,124 @@
+package main
+
+import (
+	"image/color"
+	"math/rand"
+
+	"engo.io/ecs"
+	"engo.io/engo"
+	"engo.io/engo/common"
+)
+
+var (
+	syntheticTileSize      = 32   // Width and height of the tiles in synthetic worlds, in pixels
+	syntheticWaterFraction = 0.08 // Fraction of the inside of a synthetic world that is water
+)
+
+// setupSynthetic sets ms up with a generated width by height tile map instead of world.tmx, and adds the simulation systems to world
+// The map is walled in, has water scattered through it from seed and food everywhere else, just like world.tmx
+// Water is solid if solidLayers includes the Water Layer, the same as it would be in world.tmx
+// Nothing that needs a window is added, so this can be used to run the simulation headlessly
+func (ms *MapScene) setupSynthetic(world *ecs.World, width, height, minCreatures int, seed int64) {
+	ms.addSimulationSystems(world, minCreatures)
+
+	ms.tileWidth, ms.tileHeight = syntheticTileSize, syntheticTileSize
+	ms.width, ms.height = width, height
+	ms.tiles = newTileGrid(width, height)
+
+	// Pick where the walls and water are, making sure there's at least some water so food tiles have something to be near
+	r := rand.New(rand.NewSource(seed))
+	const (
+		food = iota
+		water
+		wall
+	)
+	kinds := make([][]int, height)
+	for y := range kinds {
+		kinds[y] = make([]int, width)
+		for x := range kinds[y] {
+			switch {
+			case x == 0 || y == 0 || x == width-1 || y == height-1:
+				kinds[y][x] = wall
+			case r.Float64() < syntheticWaterFraction:
+				kinds[y][x] = water
+			}
+		}
+	}
+	if width > 2 && height > 2 {
+		kinds[height/2][width/2] = water
+	}
+
+	// Food tiles get their water distance the same way as in Setup, which is the Manhattan distance to the closest water tile
+	distances := waterDistances(kinds, water)
+
+	var solidTiles []*tileEntity
+	for y := range kinds {
+		for x, kind := range kinds[y] {
+			tile := &tileEntity{BasicEntity: ecs.NewBasic()}
+			tile.RenderComponent = common.RenderComponent{
+				Drawable: common.Rectangle{},
+				Scale:    engo.Point{X: 1, Y: 1},
+			}
+			switch kind {
+			case wall:
+				tile.RenderComponent.Color = color.Black
+				solidTiles = append(solidTiles, tile)
+			case water:
+				tile.RenderComponent.SetZIndex(1)
+				tile.foodComponent.deadly = true
+				if isSolidLayer("Water Layer") { // So that water behaves the same as it does in world.tmx
+					solidTiles = append(solidTiles, tile)
+				}
+			case food:
+				tile.foodComponent.setWaterDistance(float32(distances[y][x]))
+				tile.RenderComponent.Color = tile.foodComponent.color()
+			}
+			tile.SpaceComponent = common.SpaceComponent{
+				Position: engo.Point{X: float32(x * ms.tileWidth), Y: float32(y * ms.tileHeight)},
+				Width:    float32(ms.tileWidth),
+				Height:   float32(ms.tileHeight),
+			}
+			ms.tiles.set(x, y, tile)
+		}
+	}
+
+	ms.addTiles(world, solidTiles)
+}
+
+// waterDistances finds the Manhattan distance from every cell in kinds to the closest cell of kind water,
+// by doing a breadth first search outwards from all of the water at once
+// Cells that can't reach any water get a distance of 0
+func waterDistances(kinds [][]int, water int) [][]int {
+	type cell struct{ x, y int }
+	distances := make([][]int, len(kinds))
+	var queue []cell
+	for y := range kinds {
+		distances[y] = make([]int, len(kinds[y]))
+		for x := range kinds[y] {
+			if kinds[y][x] == water {
+				queue = append(queue, cell{x, y})
+			} else {
+				distances[y][x] = -1
+			}
+		}
+	}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		for _, n := range []cell{{c.x + 1, c.y}, {c.x - 1, c.y}, {c.x, c.y + 1}, {c.x, c.y - 1}} {
+			if n.y < 0 || n.y >= len(distances) || n.x < 0 || n.x >= len(distances[n.y]) || distances[n.y][n.x] >= 0 {
+				continue
+			}
+			distances[n.y][n.x] = distances[c.y][c.x] + 1
+			queue = append(queue, n)
+		}
+	}
+	for y := range distances {
+		for x := range distances[y] {
+			if distances[y][x] < 0 {
+				distances[y][x] = 0
+			}
+		}
+	}
+	return distances
+}
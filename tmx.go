@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const tmxGIDMask = 0x0fffffff // Tiled keeps flip and rotation flags in the top bits of each gid
+
+var solidTileProperty = "solid" // Tiles whose tileset gives them this property with the value true are solid
+
+// engo's TMX loader throws tile properties away, so we read the bits of the map we need ourselves
+type tmxMap struct {
+	Width    int          `xml:"width,attr"`
+	Height   int          `xml:"height,attr"`
+	Tilesets []tmxTileset `xml:"tileset"`
+	Layers   []tmxLayer   `xml:"layer"`
+}
+
+type tmxTileset struct {
+	FirstGID uint32    `xml:"firstgid,attr"`
+	Source   string    `xml:"source,attr"` // Set if the tileset is in a separate .tsx file
+	Tiles    []tmxTile `xml:"tile"`
+}
+
+type tmxTile struct {
+	ID         uint32        `xml:"id,attr"`
+	Properties []tmxProperty `xml:"properties>property"`
+}
+
+type tmxProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type tmxLayer struct {
+	Name string  `xml:"name,attr"`
+	Data tmxData `xml:"data"`
+}
+
+type tmxData struct {
+	Encoding    string `xml:"encoding,attr"`
+	Compression string `xml:"compression,attr"`
+	Raw         string `xml:",chardata"`
+	Tiles       []struct {
+		GID uint32 `xml:"gid,attr"`
+	} `xml:"tile"`
+}
+
+// solidTileMap holds which tiles of each layer have the solidTileProperty
+type solidTileMap struct {
+	width, height int
+	layers        map[string][]bool // Indexed by y*width+x
+}
+
+// solid tells us if the tile at x, y in layer is solid, the zero solidTileMap has no solid tiles
+func (s solidTileMap) solid(layer string, x, y int) bool {
+	cells, ok := s.layers[layer]
+	if !ok || x < 0 || x >= s.width || y < 0 || y >= s.height {
+		return false
+	}
+	return cells[y*s.width+x]
+}
+
+// readSolidTiles finds the solid tiles of every layer in the TMX map at path
+func readSolidTiles(path string) (solidTileMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return solidTileMap{}, err
+	}
+	defer f.Close()
+	return parseSolidTiles(f, filepath.Dir(path))
+}
+
+// parseSolidTiles finds the solid tiles of every layer in the TMX map read from r,
+// external tilesets are looked for relative to dir
+func parseSolidTiles(r io.Reader, dir string) (solidTileMap, error) {
+	var m tmxMap
+	if err := xml.NewDecoder(r).Decode(&m); err != nil {
+		return solidTileMap{}, err
+	}
+
+	solidGIDs := make(map[uint32]bool)
+	for _, ts := range m.Tilesets {
+		tiles := ts.Tiles
+		if ts.Source != "" {
+			external, err := readTileset(filepath.Join(dir, ts.Source))
+			if err != nil {
+				return solidTileMap{}, err
+			}
+			tiles = external.Tiles
+		}
+		for _, t := range tiles {
+			for _, p := range t.Properties {
+				if p.Name == solidTileProperty && p.Value == "true" {
+					solidGIDs[ts.FirstGID+t.ID] = true
+				}
+			}
+		}
+	}
+
+	s := solidTileMap{width: m.Width, height: m.Height, layers: make(map[string][]bool, len(m.Layers))}
+	for _, layer := range m.Layers {
+		gids, err := layer.Data.gids()
+		if err != nil {
+			return solidTileMap{}, fmt.Errorf("layer %q: %v", layer.Name, err)
+		}
+		cells := make([]bool, m.Width*m.Height)
+		for i, gid := range gids {
+			if i < len(cells) {
+				cells[i] = solidGIDs[gid&tmxGIDMask]
+			}
+		}
+		s.layers[layer.Name] = cells
+	}
+	return s, nil
+}
+
+// readTileset reads an external .tsx tileset
+func readTileset(path string) (tmxTileset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return tmxTileset{}, err
+	}
+	defer f.Close()
+	var ts tmxTileset
+	err = xml.NewDecoder(f).Decode(&ts)
+	return ts, err
+}
+
+// gids decodes the gid of every tile in the layer, in row-major order, with the flip flags left in
+func (d tmxData) gids() ([]uint32, error) {
+	switch d.Encoding {
+	case "":
+		gids := make([]uint32, len(d.Tiles))
+		for i, t := range d.Tiles {
+			gids[i] = t.GID
+		}
+		return gids, nil
+	case "csv":
+		fields := strings.Split(strings.TrimSpace(d.Raw), ",")
+		gids := make([]uint32, len(fields))
+		for i, field := range fields {
+			gid, err := strconv.ParseUint(strings.TrimSpace(field), 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			gids[i] = uint32(gid)
+		}
+		return gids, nil
+	case "base64":
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(d.Raw))
+		if err != nil {
+			return nil, err
+		}
+		var r io.Reader = bytes.NewReader(raw)
+		switch d.Compression {
+		case "zlib":
+			if r, err = zlib.NewReader(r); err != nil {
+				return nil, err
+			}
+		case "gzip":
+			if r, err = gzip.NewReader(r); err != nil {
+				return nil, err
+			}
+		case "":
+		default:
+			return nil, fmt.Errorf("unsupported compression %q", d.Compression)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		gids := make([]uint32, len(data)/4)
+		for i := range gids {
+			gids[i] = binary.LittleEndian.Uint32(data[i*4:])
+		}
+		return gids, nil
+	}
+	return nil, fmt.Errorf("unsupported encoding %q", d.Encoding)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSolidTiles(t *testing.T) {
+	const tileset = `<tileset firstgid="1" name="ts" tilewidth="32" tileheight="32" tilecount="2">
+  <tile id="1"><properties><property name="solid" type="bool" value="true"/></properties></tile>
+ </tileset>`
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"xml", `<data><tile gid="1"/><tile gid="2"/><tile gid="0"/><tile gid="2147483650"/></data>`},
+		{"csv", `<data encoding="csv">
+1,2,
+0,2147483650
+</data>`},
+		{"base64", `<data encoding="base64">AQAAAAIAAAAAAAAAAgAAgA==</data>`},
+		{"base64 zlib", `<data encoding="base64" compression="zlib">eJxjZGBgYGKAACDdAAAAwACG</data>`},
+		{"base64 gzip", `<data encoding="base64" compression="gzip">H4sIAAAAAAAC/2NkYGBgYoAAIN0AAPAPWekQAAAA</data>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmx := `<map width="2" height="2">` + tileset + `<layer name="Walls" width="2" height="2">` + tt.data + `</layer></map>`
+			s, err := parseSolidTiles(strings.NewReader(tmx), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// gid 2 is solid, and the last tile is gid 2 flipped horizontally
+			want := [][]bool{{false, true}, {false, true}}
+			for y := range want {
+				for x := range want[y] {
+					if got := s.solid("Walls", x, y); got != want[y][x] {
+						t.Errorf("solid(%d, %d) = %v, want %v", x, y, got, want[y][x])
+					}
+				}
+			}
+			if s.solid("Other Layer", 1, 0) || s.solid("Walls", 2, 0) {
+				t.Error("want tiles in missing layers or outside the map to not be solid")
+			}
+		})
+	}
+}
+
+func TestParseSolidTilesExternalTileset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gevo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tsx := `<tileset name="ts"><tile id="0"><properties><property name="solid" value="true"/></properties></tile></tileset>`
+	if err := ioutil.WriteFile(filepath.Join(dir, "ts.tsx"), []byte(tsx), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmx := `<map width="2" height="1"><tileset firstgid="5" source="ts.tsx"/><layer name="Walls"><data encoding="csv">5,6</data></layer></map>`
+	s, err := parseSolidTiles(strings.NewReader(tmx), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.solid("Walls", 0, 0) || s.solid("Walls", 1, 0) {
+		t.Errorf("want only the first tile to be solid, got %v", s.layers["Walls"])
+	}
+}
+
+func TestReadSolidTilesWorld(t *testing.T) {
+	s, err := readSolidTiles(filepath.Join("assets", "world.tmx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.width != 100 || s.height != 100 {
+		t.Errorf("map size = %dx%d, want 100x100", s.width, s.height)
+	}
+	for _, name := range []string{"Water Layer", "Food Layer"} {
+		if len(s.layers[name]) != s.width*s.height {
+			t.Errorf("%s has %d tiles, want %d", name, len(s.layers[name]), s.width*s.height)
+		}
+	}
+	for _, name := range solidLayers {
+		if _, ok := s.layers[name]; !ok {
+			t.Errorf("solidLayers names %q, which isn't a layer in world.tmx", name)
+		}
+	}
+}
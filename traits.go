@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+var (
+	traitMutationStrength float64 = 0.05      // Standard deviation of the normally distributed amount added to every inherited trait, as a fraction of its range
+	dietTradeoff          float64 = 1.5       // Exponent of the diet trade-off curve, above 1 favours specialists and below 1 favours generalists
+	colorBy                       = "species" // What creatures are coloured by, either "species" or "traits"
+)
+
+// TraitComponent holds heritable traits that aren't part of a creature's brain
+type TraitComponent struct {
+	// Diet is between 0 (a pure herbivore) and 1 (a pure carnivore)
+	Diet float32
+	// BaseSize multiplies the diameter a creature has for the amount of food it's storing
+	BaseSize float32
+	// MaxSpeed is the fastest a creature can move, in pixels per second
+	MaxSpeed float32
+	// TurnRate is the fastest a creature can turn, in radians per second
+	TurnRate float32
+	// Elasticity is how bouncy a creature's physics shape is
+	Elasticity float32
+	// Red, Green and Blue make up the colour of a creature when colorBy is "traits"
+	Red, Green, Blue float32
+}
+
+// traitField describes a single trait, which is always kept between min and max
+// cost is the food used per tick by a creature whose trait is at max, and scales linearly down to nothing at min
+type traitField struct {
+	value    *float32
+	min, max float32
+	cost     float32
+}
+
+// fields returns every trait in t in a fixed order
+func (t *TraitComponent) fields() []traitField {
+	return []traitField{
+		{value: &t.Diet, min: 0, max: 1},
+		{value: &t.BaseSize, min: 0.5, max: 1.5, cost: 0.06},
+		{value: &t.MaxSpeed, min: 20, max: 200, cost: 0.08},
+		{value: &t.TurnRate, min: 0.5, max: 6, cost: 0.03},
+		{value: &t.Elasticity, min: 0, max: 1, cost: 0.01},
+		{value: &t.Red, min: 0, max: 1, cost: 0.005}, // Pigment isn't free, but it's cheap
+		{value: &t.Green, min: 0, max: 1, cost: 0.005},
+		{value: &t.Blue, min: 0, max: 1, cost: 0.005},
+	}
+}
+
+// randomTraits makes a TraitComponent for a creature that has no parents, using r
+func randomTraits(r *rand.Rand) TraitComponent {
+	var t TraitComponent
+	for _, f := range t.fields() {
+		*f.value = f.min + r.Float32()*(f.max-f.min)
+	}
+	return t
+}
+
+// inheritTraits makes a TraitComponent from the mean of the traits of parents, and then mutates it using r
+func inheritTraits(r *rand.Rand, parents []*Creature) TraitComponent {
+	var t TraitComponent
+	fields := t.fields()
+	for _, p := range parents {
+		for i, pf := range p.TraitComponent.fields() {
+			*fields[i].value += *pf.value / float32(len(parents))
+		}
+	}
+
+	for _, f := range fields {
+		*f.value += float32(r.NormFloat64()*traitMutationStrength) * (f.max - f.min)
+		*f.value = clampTrait(*f.value, f.min, f.max)
+	}
+	return t
+}
+
+// traits returns the traits in t in a fixed order, each scaled to be between 0 and 1 so that they can be made part of a genome
+func (t *TraitComponent) traits() []float32 {
+	fields := t.fields()
+	traits := make([]float32, len(fields))
+	for i, f := range fields {
+		traits[i] = (*f.value - f.min) / (f.max - f.min)
+	}
+	return traits
+}
+
+// metabolicCost is the food used per tick just to have these traits
+func (t *TraitComponent) metabolicCost() float32 {
+	var cost float32
+	for _, f := range t.fields() {
+		cost += f.cost * (*f.value - f.min) / (f.max - f.min)
+	}
+	return cost
+}
+
+// color is the colour of a creature with these traits
+func (t *TraitComponent) color() color.RGBA {
+	return color.RGBA{uint8(t.Red * 255), uint8(t.Green * 255), uint8(t.Blue * 255), 200}
+}
+
+// plantEfficiency is the fraction of the food on a plant tile that a creature with this diet gets when it eats
+func (t *TraitComponent) plantEfficiency() float32 {
+	return float32(math.Pow(float64(1-t.Diet), dietTradeoff))
+}
+
+// meatEfficiency is the fraction of the food from other creatures that a creature with this diet gets when it eats
+func (t *TraitComponent) meatEfficiency() float32 {
+	return float32(math.Pow(float64(t.Diet), dietTradeoff))
+}
+
+func clampTrait(v, min, max float32) float32 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// validateDietFlags checks the diet tunables
+func validateDietFlags() error {
+	if dietTradeoff <= 0 {
+		return fmt.Errorf("-diet-tradeoff must be positive, got %v", dietTradeoff)
+	}
+	return nil
+}
+
+// validateColorFlags checks what creatures are coloured by
+func validateColorFlags() error {
+	return checkChoice("color-by", colorBy, "species", "traits")
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"image"
 	"math"
 
 	"github.com/vova616/chipmunk/vect"
@@ -37,3 +38,53 @@ func AddDegrees(degrees float32, delta float32) float32 {
 func PntToVect(p engo.Point) vect.Vect {
 	return vect.Vect{X: vect.Float(p.X), Y: vect.Float(p.Y)}
 }
+
+// MergeRects covers every true cell in grid (indexed grid[y][x]) with as few non-overlapping
+// rectangles as it can manage, by greedily growing each rectangle right and then down
+// The rectangles are in cell coordinates, and rows of grid may have different lengths
+func MergeRects(grid [][]bool) []image.Rectangle {
+	covered := make([][]bool, len(grid))
+	for y := range grid {
+		covered[y] = make([]bool, len(grid[y]))
+	}
+	filled := func(x, y int) bool {
+		return y < len(grid) && x < len(grid[y]) && grid[y][x] && !covered[y][x]
+	}
+
+	var rects []image.Rectangle
+	for y := range grid {
+		for x := range grid[y] {
+			if !filled(x, y) {
+				continue
+			}
+
+			// Grow right as far as we can
+			maxX := x + 1
+			for filled(maxX, y) {
+				maxX++
+			}
+			// Then grow down as long as the whole width of the next row is free
+			maxY := y + 1
+			for ; maxY < len(grid); maxY++ {
+				rowFilled := true
+				for i := x; i < maxX; i++ {
+					if !filled(i, maxY) {
+						rowFilled = false
+						break
+					}
+				}
+				if !rowFilled {
+					break
+				}
+			}
+
+			for cy := y; cy < maxY; cy++ {
+				for cx := x; cx < maxX; cx++ {
+					covered[cy][cx] = true
+				}
+			}
+			rects = append(rects, image.Rect(x, y, maxX, maxY))
+		}
+	}
+	return rects
+}
@@ -0,0 +1,71 @@
+package util
+
+import (
+	"image"
+	"testing"
+)
+
+// parseGrid turns rows of # (true) and . (false) into a grid, rows can have different lengths
+func parseGrid(rows ...string) [][]bool {
+	grid := make([][]bool, len(rows))
+	for y, row := range rows {
+		grid[y] = make([]bool, len(row))
+		for x, cell := range row {
+			grid[y][x] = cell == '#'
+		}
+	}
+	return grid
+}
+
+func TestMergeRects(t *testing.T) {
+	tests := []struct {
+		name      string
+		grid      [][]bool
+		wantRects int // -1 if we don't care how many there are
+	}{
+		{"nil", nil, 0},
+		{"empty rows", [][]bool{{}, {}}, 0},
+		{"all false", parseGrid("...", "..."), 0},
+		{"single cell", parseGrid("...", ".#."), 1},
+		{"rectangle", parseGrid(".###", ".###", ".###"), 1},
+		{"L-shape", parseGrid("#..", "#..", "###"), 2},
+		{"ragged rows", parseGrid("###", "##", "####"), 3},
+		{"holes", parseGrid("#####", "#.#.#", "#####"), -1},
+		{"checkerboard", parseGrid("#.#", ".#.", "#.#"), 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rects := MergeRects(tt.grid)
+			if tt.wantRects >= 0 && len(rects) != tt.wantRects {
+				t.Errorf("got %d rectangles %v, want %d", len(rects), rects, tt.wantRects)
+			}
+
+			// Every true cell is covered exactly once, and nothing else is covered at all
+			counts := make(map[image.Point]int)
+			for _, r := range rects {
+				if r.Empty() {
+					t.Errorf("empty rectangle %v", r)
+				}
+				for y := r.Min.Y; y < r.Max.Y; y++ {
+					for x := r.Min.X; x < r.Max.X; x++ {
+						counts[image.Pt(x, y)]++
+					}
+				}
+			}
+			for p, n := range counts {
+				if p.Y >= len(tt.grid) || p.X >= len(tt.grid[p.Y]) || !tt.grid[p.Y][p.X] {
+					t.Errorf("%v isn't true in the grid but is covered", p)
+				} else if n > 1 {
+					t.Errorf("%v is covered by %d rectangles", p, n)
+				}
+			}
+			for y := range tt.grid {
+				for x, solid := range tt.grid[y] {
+					if solid && counts[image.Pt(x, y)] == 0 {
+						t.Errorf("%v isn't covered", image.Pt(x, y))
+					}
+				}
+			}
+		})
+	}
+}